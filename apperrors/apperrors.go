@@ -0,0 +1,101 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors, each maps to one HTTP status code.
+// Use errors.Is(err, apperrors.ErrNotFound) to test the kind of any *Error.
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrValidation           = errors.New("validation failed")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrPayloadTooLarge      = errors.New("payload too large")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrTooManyRequests      = errors.New("too many requests")
+	ErrInternal             = errors.New("internal error")
+)
+
+// Error is a domain error with a stable machine readable code and a human readable message
+type Error struct {
+	Kind       error          // One of the Err* kinds above
+	Code       string         // Stable identifier clients can rely on, e.g. "event_not_found"
+	Message    string         // Human readable explanation, may change over time
+	Fields     []FieldError   // Per-field details of validation errors
+	Extensions map[string]any // Additional members included in the response
+	Cause      error          // Underlying error, logged but never sent to clients
+}
+
+// FieldError describes one field that failed a validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause != nil {
+		return []error{e.Kind, e.Cause}
+	}
+	return []error{e.Kind}
+}
+
+// With returns a copy of the error carrying an additional response member
+func (e *Error) With(key string, value any) *Error {
+	copied := *e
+	copied.Extensions = make(map[string]any, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return &copied
+}
+
+func New(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func BadRequest(code, message string) *Error {
+	return New(ErrBadRequest, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(ErrUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(ErrForbidden, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(ErrNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(ErrConflict, code, message)
+}
+
+func PreconditionFailed(code, message string) *Error {
+	return New(ErrPreconditionFailed, code, message)
+}
+
+func Validation(message string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: "validation_failed", Message: message, Fields: fields}
+}
+
+func Internal(message string, cause error) *Error {
+	return &Error{Kind: ErrInternal, Code: "internal_error", Message: message, Cause: cause}
+}
@@ -0,0 +1,27 @@
+package buildinfo
+
+import "runtime"
+
+// Injected at build time with
+// -ldflags "-X github.com/ftilie/go-booking-api/buildinfo.Version=... -X github.com/ftilie/go-booking-api/buildinfo.Commit=... -X github.com/ftilie/go-booking-api/buildinfo.BuildTime=..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,219 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ftilie/go-booking-api/models"
+)
+
+// Reads and writes RFC 5545 iCalendar documents for events
+
+const (
+	productId  = "-//ftilie//go-booking-api//EN"
+	uidDomain  = "go-booking-api"
+	timeFormat = "20060102T150405Z"
+	lineLimit  = 75 // Maximum line length in octets before folding
+)
+
+func Encode(name string, events []models.Event) string {
+	// This function will render the events as a VCALENDAR containing one VEVENT per event
+	var builder strings.Builder
+	writeLine(&builder, "BEGIN:VCALENDAR")
+	writeLine(&builder, "VERSION:2.0")
+	writeLine(&builder, "PRODID:"+productId)
+	writeLine(&builder, "CALSCALE:GREGORIAN")
+	writeLine(&builder, "METHOD:PUBLISH")
+	if name != "" {
+		writeLine(&builder, "X-WR-CALNAME:"+escapeText(name))
+	}
+	for _, event := range events {
+		writeEvent(&builder, event)
+	}
+	writeLine(&builder, "END:VCALENDAR")
+	return builder.String()
+}
+
+func writeEvent(builder *strings.Builder, event models.Event) {
+	// Clients match updates by UID and apply them when SEQUENCE increases
+	status := "CONFIRMED"
+	if event.DeletedAt != nil {
+		status = "CANCELLED"
+	}
+	stamp := event.CreatedAt
+	if event.DeletedAt != nil {
+		stamp = *event.DeletedAt
+	} else if event.UpdatedAt != nil {
+		stamp = *event.UpdatedAt
+	}
+
+	writeLine(builder, "BEGIN:VEVENT")
+	writeLine(builder, fmt.Sprintf("UID:event-%d@%s", event.Id, uidDomain))
+	writeLine(builder, "DTSTAMP:"+formatTime(stamp))
+	writeLine(builder, "DTSTART:"+formatTime(event.StartTime))
+	writeLine(builder, "DTEND:"+formatTime(event.EndTime))
+	writeLine(builder, "SUMMARY:"+escapeText(event.Title))
+	if event.Description != "" {
+		writeLine(builder, "DESCRIPTION:"+escapeText(event.Description))
+	}
+	if event.Location != "" {
+		writeLine(builder, "LOCATION:"+escapeText(event.Location))
+	}
+	writeLine(builder, fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	writeLine(builder, "STATUS:"+status)
+	writeLine(builder, "CREATED:"+formatTime(event.CreatedAt))
+	if event.UpdatedAt != nil {
+		writeLine(builder, "LAST-MODIFIED:"+formatTime(*event.UpdatedAt))
+	}
+	writeLine(builder, "END:VEVENT")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func escapeText(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return replacer.Replace(text)
+}
+
+func writeLine(builder *strings.Builder, line string) {
+	// Lines longer than 75 octets are folded with CRLF followed by a space,
+	// taking care not to split a multi-byte UTF-8 character
+	limit := lineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		builder.WriteString(line[:cut])
+		builder.WriteString("\r\n ")
+		line = line[cut:]
+		limit = lineLimit - 1 // Continuation lines start with a space
+	}
+	builder.WriteString(line)
+	builder.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// DecodedEvent is an event read from an iCalendar document along with the problems found while reading it
+type DecodedEvent struct {
+	Index  int // Position of the VEVENT in the document, starting at 1
+	Event  models.Event
+	Errors []string
+}
+
+func Decode(document string) ([]DecodedEvent, error) {
+	// This function will read the VEVENTs of an iCalendar document into events
+	lines := unfoldLines(document)
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("document is not an iCalendar file")
+	}
+
+	var decoded []DecodedEvent
+	var current *DecodedEvent
+	for _, line := range lines {
+		name, params, value, ok := parseContentLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current = &DecodedEvent{Index: len(decoded) + 1}
+		case name == "END" && strings.EqualFold(value, "VEVENT") && current != nil:
+			decoded = append(decoded, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "SUMMARY":
+			current.Event.Title = unescapeText(value)
+		case name == "DESCRIPTION":
+			current.Event.Description = unescapeText(value)
+		case name == "LOCATION":
+			current.Event.Location = unescapeText(value)
+		case name == "DTSTART", name == "DTEND":
+			parsed, err := parseTime(value, params)
+			if err != nil {
+				current.Errors = append(current.Errors, fmt.Sprintf("%s: %s", name, err.Error()))
+				continue
+			}
+			if name == "DTSTART" {
+				current.Event.StartTime = parsed
+			} else {
+				current.Event.EndTime = parsed
+			}
+		}
+	}
+	return decoded, nil
+}
+
+func unfoldLines(document string) []string {
+	// Continuation lines start with a space or a tab and belong to the previous line
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func parseContentLine(line string) (string, map[string]string, string, bool) {
+	// Content lines look like NAME;PARAM=VALUE:content
+	head, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, part := range parts[1:] {
+		key, paramValue, _ := strings.Cut(part, "=")
+		params[strings.ToUpper(key)] = strings.Trim(paramValue, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+func parseTime(value string, params map[string]string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		return time.Parse("20060102", value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(timeFormat, value)
+	}
+	location := time.UTC
+	if tzid, ok := params["TZID"]; ok {
+		loaded, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", tzid)
+		}
+		location = loaded
+	}
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+func unescapeText(text string) string {
+	replacer := strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	)
+	return replacer.Replace(text)
+}
@@ -0,0 +1,90 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ftilie/go-booking-api/models"
+)
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	// The description crosses several folds, which would fall inside its two and three byte characters
+	description := "Ședință " + strings.Repeat("ș☕", 40)
+	document := Encode("", []models.Event{{Id: 1, Title: "Go meetup", Description: description}})
+
+	if !strings.HasSuffix(document, "\r\n") {
+		t.Error("document does not end with CRLF")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(document, "\r\n"), "\r\n") {
+		if len(line) > lineLimit {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+
+	decoded, err := Decode(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Event.Description != description {
+		t.Fatalf("unfolded description = %q, want %q", decoded[0].Event.Description, description)
+	}
+}
+
+func TestEncodeEscapesText(t *testing.T) {
+	event := models.Event{Id: 1, Title: `Go; Rust, and C\C++`, Location: "Room 1\r\nFloor 2", Description: "Line one\nLine two"}
+	document := Encode("Team, events", []models.Event{event})
+
+	for _, want := range []string{
+		`X-WR-CALNAME:Team\, events` + "\r\n",
+		`SUMMARY:Go\; Rust\, and C\\C++` + "\r\n",
+		`LOCATION:Room 1\nFloor 2` + "\r\n",
+		`DESCRIPTION:Line one\nLine two` + "\r\n",
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document does not contain %q:\n%s", want, document)
+		}
+	}
+
+	decoded, err := Decode(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded[0].Event; got.Title != event.Title || got.Location != "Room 1\nFloor 2" || got.Description != event.Description {
+		t.Errorf("decoded %+v, want the original text", got)
+	}
+}
+
+func TestEncodeTimesInUTC(t *testing.T) {
+	bucharest := time.FixedZone("EEST", 3*60*60)
+	created := time.Date(2026, time.May, 1, 9, 0, 0, 0, bucharest)
+	deleted := time.Date(2026, time.May, 20, 23, 30, 0, 0, bucharest)
+	event := models.Event{
+		Id:        7,
+		Title:     "Go meetup",
+		StartTime: time.Date(2026, time.June, 1, 1, 30, 0, 0, bucharest),
+		EndTime:   time.Date(2026, time.June, 1, 3, 0, 0, 0, bucharest),
+		CreatedAt: created,
+		DeletedAt: &deleted,
+		Sequence:  3,
+	}
+	document := Encode("", []models.Event{event})
+
+	for _, want := range []string{
+		"UID:event-7@go-booking-api\r\n",
+		"DTSTART:20260531T223000Z\r\n",
+		"DTEND:20260601T000000Z\r\n",
+		"CREATED:20260501T060000Z\r\n",
+		"DTSTAMP:20260520T203000Z\r\n", // Cancelled events are stamped when they were deleted
+		"SEQUENCE:3\r\n",
+		"STATUS:CANCELLED\r\n",
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("document does not contain %q:\n%s", want, document)
+		}
+	}
+}
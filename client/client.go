@@ -0,0 +1,309 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultMinBackoff = 200 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+	refreshMargin     = time.Minute      // Tokens are renewed this long before they expire
+	loginTimeout      = 30 * time.Second // Bounds a shared login, which no single caller can cancel
+)
+
+// errWaitTooLong means the server asked to wait longer than the client's maximum backoff before retrying
+var errWaitTooLong = errors.New("retry-after exceeds the maximum backoff")
+
+// Client calls the booking API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mutex    sync.Mutex
+	logins   singleflight.Group
+	email    string
+	password string
+	token    string
+	expiry   time.Time
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCredentials makes the client log in by itself, and log in again whenever its token expires
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithToken uses a token obtained elsewhere, it is not renewed unless credentials are given too
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+		c.expiry = tokenExpiry(token)
+	}
+}
+
+// WithRetries sets how many times failed requests are retried and the bounds of the exponential backoff between attempts
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// request describes one API call, the body is encoded as JSON unless it is already a []byte
+type request struct {
+	method        string
+	path          string
+	body          any
+	contentType   string
+	headers       map[string]string
+	authenticated bool
+	retryable     bool // Only requests that are safe to repeat are retried
+}
+
+func (c *Client) do(ctx context.Context, req request, out any) (http.Header, error) {
+	// This function will send the request, retrying transient failures and renewing an expired token once
+	var payload []byte
+	switch body := req.body.(type) {
+	case nil:
+	case []byte:
+		payload = body
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = encoded
+		if req.contentType == "" {
+			req.contentType = "application/json"
+		}
+	}
+
+	renewed := false
+	for attempt := 0; ; attempt++ {
+		httpRequest, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if req.contentType != "" {
+			httpRequest.Header.Set("Content-Type", req.contentType)
+		}
+		httpRequest.Header.Set("Accept", "application/json, application/problem+json")
+		for key, value := range req.headers {
+			httpRequest.Header.Set(key, value)
+		}
+		token := ""
+		if req.authenticated {
+			token, err = c.currentToken(ctx)
+			if err != nil {
+				return nil, err
+			}
+			httpRequest.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := c.httpClient.Do(httpRequest)
+		if err != nil {
+			if req.retryable && attempt < c.maxRetries && ctx.Err() == nil {
+				if err := c.wait(ctx, attempt, ""); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode == http.StatusUnauthorized && req.authenticated && !renewed && c.canRenew() {
+			c.forgetToken(token)
+			renewed = true
+			attempt-- // Renewing the token does not count as a retry
+			continue
+		}
+		if req.retryable && attempt < c.maxRetries && isTransient(response.StatusCode) {
+			err := c.wait(ctx, attempt, response.Header.Get("Retry-After"))
+			if errors.Is(err, errWaitTooLong) {
+				// The caller decides whether to come back that late, the error carries the wait
+				return response.Header, decodeError(response, body)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if response.StatusCode >= http.StatusBadRequest {
+			return response.Header, decodeError(response, body)
+		}
+
+		if out != nil && len(body) > 0 {
+			if err := json.Unmarshal(body, out); err != nil {
+				return response.Header, fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+			}
+		}
+		return response.Header, nil
+	}
+}
+
+func isTransient(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	// Waits as long as the server asked in Retry-After, or an exponential backoff with full jitter.
+	// A Retry-After longer than the maximum backoff is not waited for, it fails with errWaitTooLong.
+	delay := c.minBackoff << attempt
+	if delay > c.maxBackoff || delay <= 0 {
+		delay = c.maxBackoff
+	}
+	delay = mathrand.N(delay) + 1
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+		if delay > c.maxBackoff {
+			return errWaitTooLong
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	// Returns the token to send, logging in first when there is none or it is about to expire.
+	// The lock is not held during the login, concurrent calls wait for the same login instead of each starting one.
+	c.mutex.Lock()
+	token, email, password := c.token, c.email, c.password
+	fresh := c.expiry.IsZero() || time.Until(c.expiry) > refreshMargin
+	c.mutex.Unlock()
+
+	if token != "" && fresh {
+		return token, nil
+	}
+	if email == "" {
+		return token, nil // Nothing to renew with, the server decides whether the token still works
+	}
+
+	// The login is shared by every caller waiting for it, so it must not end when the one that started it gives up.
+	// Each caller still stops waiting as soon as its own context is done.
+	logins := c.logins.DoChan(email, func() (any, error) {
+		loginCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loginTimeout)
+		defer cancel()
+		token, err := c.login(loginCtx, email, password)
+		if err != nil {
+			return "", err
+		}
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.email == email { // Logout or Login with other credentials may have happened meanwhile
+			c.token = token
+			c.expiry = tokenExpiry(token)
+		}
+		return token, nil
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case result := <-logins:
+		if result.Err != nil {
+			return "", result.Err
+		}
+		return result.Val.(string), nil
+	}
+}
+
+func (c *Client) canRenew() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.email != ""
+}
+
+func (c *Client) forgetToken(token string) {
+	// Only the token that was rejected is dropped, another goroutine may already have renewed it
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+func tokenExpiry(token string) time.Time {
+	// The expiry is read from the token payload without verifying it, the server does the verification
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+func newIdempotencyKey() string {
+	// Retries of one call share the key so the server creates the resource at most once
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
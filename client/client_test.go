@@ -0,0 +1,368 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of server that retries without waiting, unless the server asks for it
+func newTestClient(t *testing.T, handler http.HandlerFunc, options ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	options = append([]Option{WithRetries(defaultMaxRetries, time.Millisecond, time.Millisecond)}, options...)
+	return New(server.URL, options...)
+}
+
+func writeProblem(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			var attempts atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) < 3 {
+					writeProblem(w, status, `{"detail":"Try again"}`)
+					return
+				}
+				w.Write([]byte(`[{"id":1}]`))
+			}, WithToken("token"))
+
+			events, err := c.ListEvents(context.Background())
+			if err != nil {
+				t.Fatalf("ListEvents: %v", err)
+			}
+			if len(events) != 1 || attempts.Load() != 3 {
+				t.Fatalf("got %d events after %d attempts, want 1 after 3", len(events), attempts.Load())
+			}
+		})
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		writeProblem(w, http.StatusServiceUnavailable, `{"detail":"Down for maintenance"}`)
+	}, WithToken("token"))
+
+	_, err := c.ListEvents(context.Background())
+	if !errors.Is(err, ErrServer) {
+		t.Fatalf("ListEvents error = %v, want ErrServer", err)
+	}
+	if attempts.Load() != defaultMaxRetries+1 {
+		t.Errorf("%d attempts, want %d", attempts.Load(), defaultMaxRetries+1)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	// The server asks for a second, far longer than the backoff of the client
+	var attempts atomic.Int32
+	var retriedAfter time.Duration
+	var first time.Time
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			writeProblem(w, http.StatusTooManyRequests, `{"detail":"Slow down"}`)
+			return
+		}
+		retriedAfter = time.Since(first)
+		w.Write([]byte(`[]`))
+	}, WithToken("token"), WithRetries(defaultMaxRetries, time.Millisecond, 2*time.Second))
+
+	if _, err := c.ListEvents(context.Background()); err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if retriedAfter < time.Second {
+		t.Errorf("retried after %s, want at least the second asked for in Retry-After", retriedAfter)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	// Waiting a day is up to the caller, the client returns the error with the wait instead of sleeping
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "86400")
+		writeProblem(w, http.StatusTooManyRequests, `{"code":"rate_limited","detail":"Too many requests"}`)
+	}, WithToken("token"))
+
+	started := time.Now()
+	_, err := c.ListEvents(context.Background())
+	var apiError *Error
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiError) {
+		t.Fatalf("ListEvents error = %v, want ErrRateLimited", err)
+	}
+	if apiError.RetryAfter != 24*time.Hour {
+		t.Errorf("RetryAfter = %s, want 24h", apiError.RetryAfter)
+	}
+	if attempts.Load() != 1 || time.Since(started) > time.Second {
+		t.Errorf("%d attempts in %s, want one without waiting", attempts.Load(), time.Since(started))
+	}
+}
+
+func TestNoRetryForUnsafeRequests(t *testing.T) {
+	// A check-in may have gone through before the failure, repeating it is up to the caller
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		writeProblem(w, http.StatusServiceUnavailable, `{"detail":"Down for maintenance"}`)
+	}, WithToken("token"))
+
+	_, err := c.CheckIn(context.Background(), 1, "ticket")
+	if !errors.Is(err, ErrServer) {
+		t.Fatalf("CheckIn error = %v, want ErrServer", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("%d attempts, want 1", attempts.Load())
+	}
+}
+
+func TestRenewRejectedToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted string // The token the server accepts
+		logins   int32
+		requests int32
+		err      error
+	}{
+		{"renewed token accepted", "renewed", 1, 2, nil},
+		{"renewed token rejected too", "none", 1, 2, ErrUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var logins, requests atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v2/login" {
+					logins.Add(1)
+					w.Write([]byte(`{"token":"renewed"}`))
+					return
+				}
+				requests.Add(1)
+				if r.Header.Get("Authorization") != "Bearer "+test.accepted {
+					writeProblem(w, http.StatusUnauthorized, `{"code":"invalid_token","detail":"Invalid or expired token"}`)
+					return
+				}
+				w.Write([]byte(`[]`))
+			}, WithToken("stale"), WithCredentials("ana@example.com", "Passw0rd!long"))
+
+			_, err := c.ListEvents(context.Background())
+			if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+				t.Fatalf("ListEvents error = %v, want %v", err, test.err)
+			}
+			if logins.Load() != test.logins || requests.Load() != test.requests {
+				t.Errorf("%d logins and %d requests, want %d and %d", logins.Load(), requests.Load(), test.logins, test.requests)
+			}
+		})
+	}
+}
+
+func TestNoRenewWithoutCredentials(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		writeProblem(w, http.StatusUnauthorized, `{"code":"invalid_token","detail":"Invalid or expired token"}`)
+	}, WithToken("stale"))
+
+	if _, err := c.ListEvents(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("ListEvents error = %v, want ErrUnauthorized", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("%d requests, want 1", requests.Load())
+	}
+}
+
+func TestConcurrentLogin(t *testing.T) {
+	// Calls waiting for a token share one login, and the login does not keep the client locked
+	release := make(chan struct{})
+	var logins atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/login" {
+			logins.Add(1)
+			<-release
+			w.Write([]byte(`{"token":"fresh"}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}, WithCredentials("ana@example.com", "Passw0rd!long"))
+
+	var calls sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			_, err := c.ListEvents(context.Background())
+			errs <- err
+		}()
+	}
+
+	for logins.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	unlocked := make(chan struct{})
+	go func() {
+		c.canRenew()
+		close(unlocked)
+	}()
+	select {
+	case <-unlocked:
+	case <-time.After(time.Second):
+		t.Error("the client stayed locked during the login")
+	}
+
+	close(release)
+	calls.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ListEvents: %v", err)
+		}
+	}
+	if logins.Load() != 1 {
+		t.Errorf("%d logins, want 1", logins.Load())
+	}
+}
+
+func TestLoginOutlivesCancelledCaller(t *testing.T) {
+	// The caller that started the shared login gives up, the others still get the token
+	release := make(chan struct{})
+	var logins atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/login" {
+			logins.Add(1)
+			<-release
+			w.Write([]byte(`{"token":"fresh"}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}, WithCredentials("ana@example.com", "Passw0rd!long"))
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.ListEvents(first)
+		firstErr <- err
+	}()
+	for logins.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	secondErr := make(chan error, 1)
+	go func() {
+		_, err := c.ListEvents(context.Background())
+		secondErr <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled ListEvents error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the cancelled caller kept waiting for the login")
+	}
+
+	close(release)
+	if err := <-secondErr; err != nil {
+		t.Errorf("ListEvents sharing the login: %v", err)
+	}
+	if logins.Load() != 1 {
+		t.Errorf("%d logins, want 1", logins.Load())
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		kind   error
+		want   Error
+	}{
+		{
+			"validation problem", http.StatusUnprocessableEntity,
+			`{"type":"urn:go-booking-api:problem:validation_failed","title":"Unprocessable Entity","status":422,"detail":"Some fields are invalid","code":"validation_failed","requestId":"abc","errors":[{"field":"title","rule":"required","message":"Is required"}]}`,
+			ErrValidation,
+			Error{StatusCode: 422, Type: "urn:go-booking-api:problem:validation_failed", Title: "Unprocessable Entity", Detail: "Some fields are invalid", Code: "validation_failed", RequestId: "abc",
+				Fields: []FieldError{{Field: "title", Rule: "required", Message: "Is required"}}},
+		},
+		{
+			"not found", http.StatusNotFound, `{"status":404,"detail":"Event not found","code":"event_not_found"}`,
+			ErrNotFound, Error{StatusCode: 404, Detail: "Event not found", Code: "event_not_found", RequestId: "from-header"},
+		},
+		{
+			"not a problem", http.StatusBadGateway, `<html>Bad gateway</html>`,
+			ErrServer, Error{StatusCode: 502, Detail: "Bad Gateway", RequestId: "from-header"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-ID", "from-header")
+				writeProblem(w, test.status, test.body)
+			}, WithToken("token"), WithRetries(0, 0, 0))
+
+			_, err := c.GetEvent(context.Background(), 1)
+			var apiError *Error
+			if !errors.As(err, &apiError) || !errors.Is(err, test.kind) {
+				t.Fatalf("GetEvent error = %v, want an *Error of kind %v", err, test.kind)
+			}
+			if apiError.Error() == "" || apiError.StatusCode != test.want.StatusCode || apiError.Type != test.want.Type ||
+				apiError.Title != test.want.Title || apiError.Detail != test.want.Detail || apiError.Code != test.want.Code ||
+				apiError.RequestId != test.want.RequestId || len(apiError.Fields) != len(test.want.Fields) {
+				t.Fatalf("GetEvent error = %+v, want %+v", *apiError, test.want)
+			}
+			for i, field := range apiError.Fields {
+				if field != test.want.Fields[i] {
+					t.Errorf("field %d = %+v, want %+v", i, field, test.want.Fields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChangesRequireETag(t *testing.T) {
+	// Skipping the version check must be asked for with AnyVersion, an empty ETag is a mistake
+	var ifMatch []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+		w.Write([]byte(`{"event":{"id":1}}`))
+	}, WithToken("token"))
+	ctx := context.Background()
+	title := "Renamed"
+
+	if _, err := c.UpdateEvent(ctx, 1, "", EventChanges{Title: &title}); !errors.Is(err, errNoETag) {
+		t.Errorf("UpdateEvent without an ETag error = %v", err)
+	}
+	if _, err := c.DeleteEvent(ctx, 1, ""); !errors.Is(err, errNoETag) {
+		t.Errorf("DeleteEvent without an ETag error = %v", err)
+	}
+	if _, err := c.SetCancellationPolicy(ctx, 1, "", CancellationPolicy{}); !errors.Is(err, errNoETag) {
+		t.Errorf("SetCancellationPolicy without an ETag error = %v", err)
+	}
+	if len(ifMatch) != 0 {
+		t.Fatalf("%d requests sent without an ETag", len(ifMatch))
+	}
+
+	if _, err := c.UpdateEvent(ctx, 1, `"3"`, EventChanges{Title: &title}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetCancellationPolicy(ctx, 1, AnyVersion, CancellationPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ifMatch) != 2 || ifMatch[0] != `"3"` || ifMatch[1] != "*" {
+		t.Errorf("sent If-Match %q, want the ETag then *", ifMatch)
+	}
+}
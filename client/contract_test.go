@@ -0,0 +1,86 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/models"
+)
+
+// jsonMembers returns the JSON members of a struct with the kind of value each one holds
+func jsonMembers(structType reflect.Type) map[string]string {
+	members := map[string]string{}
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		members[name] = jsonKind(field.Type)
+	}
+	return members
+}
+
+func jsonKind(valueType reflect.Type) string {
+	if valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+	switch {
+	case valueType == reflect.TypeFor[time.Time]():
+		return "timestamp"
+	case valueType.Kind() == reflect.Slice:
+		return "array of " + jsonKind(valueType.Elem())
+	case valueType.Kind() == reflect.Struct:
+		return "object " + valueType.Name()
+	case valueType.Kind() == reflect.String:
+		return "string"
+	case valueType.Kind() == reflect.Bool:
+		return "boolean"
+	}
+	return "number"
+}
+
+func TestTypesMatchAPI(t *testing.T) {
+	// The client types mirror the v2 documents, a member renamed, added or retyped on either side fails here
+	tests := []struct {
+		client, api any
+		extra       bool // The client type has members the API ignores
+	}{
+		{Event{}, dto.Event{}, false},
+		{NewEvent{}, dto.NewEvent{}, false},
+		{EventChanges{}, models.EventChanges{}, false},
+		{CancellationPolicy{}, dto.CancellationPolicy{}, false},
+		{Registration{}, dto.Registration{}, false},
+		{RegistrationRequest{}, dto.RegistrationRequest{}, false},
+		{Refund{}, dto.Refund{}, false},
+		{TicketType{}, dto.TicketType{}, false},
+		{DiscountCode{}, dto.DiscountCode{}, false},
+		{DiscountCode{}, dto.NewDiscountCode{}, true}, // CreateDiscountCode sends a DiscountCode
+	}
+	for _, test := range tests {
+		clientType, apiType := reflect.TypeOf(test.client), reflect.TypeOf(test.api)
+		t.Run(clientType.String()+" "+apiType.String(), func(t *testing.T) {
+			clientMembers, apiMembers := jsonMembers(clientType), jsonMembers(apiType)
+			for name, kind := range clientMembers {
+				apiKind, ok := apiMembers[name]
+				if !ok && !test.extra {
+					t.Errorf("%s has member %q, %s does not", clientType, name, apiType)
+				}
+				if ok && apiKind != kind {
+					t.Errorf("member %q is a %s in %s, a %s in %s", name, kind, clientType, apiKind, apiType)
+				}
+			}
+			for name := range apiMembers {
+				if _, ok := clientMembers[name]; !ok {
+					t.Errorf("%s has member %q, %s does not", apiType, name, clientType)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kinds of API errors, use errors.Is(err, client.ErrNotFound) to test the kind of an *Error
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrValidation           = errors.New("validation failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrRateLimited          = errors.New("rate limited")
+	ErrServer               = errors.New("server error")
+)
+
+var kinds = map[int]error{
+	http.StatusBadRequest:           ErrBadRequest,
+	http.StatusUnauthorized:         ErrUnauthorized,
+	http.StatusForbidden:            ErrForbidden,
+	http.StatusNotFound:             ErrNotFound,
+	http.StatusConflict:             ErrConflict,
+	http.StatusPreconditionFailed:   ErrPreconditionFailed,
+	http.StatusUnprocessableEntity:  ErrValidation,
+	http.StatusPreconditionRequired: ErrPreconditionRequired,
+	http.StatusTooManyRequests:      ErrRateLimited,
+}
+
+// Error is an error response of the API, decoded from its RFC 7807 problem details
+type Error struct {
+	StatusCode int          `json:"status"`
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail"`
+	Code       string       `json:"code"` // Stable error code, e.g. "event_not_found"
+	RequestId  string       `json:"requestId"`
+	Fields     []FieldError `json:"errors"`
+
+	RetryAfter time.Duration `json:"-"` // How long the server asked to wait before trying again, from Retry-After
+}
+
+// FieldError describes one field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Detail)
+	}
+	return fmt.Sprintf("api error %d %s: %s", e.StatusCode, e.Code, e.Detail)
+}
+
+func (e *Error) Is(target error) bool {
+	if kind, ok := kinds[e.StatusCode]; ok {
+		return kind == target
+	}
+	return target == ErrServer && e.StatusCode >= http.StatusInternalServerError
+}
+
+func decodeError(response *http.Response, body []byte) error {
+	// Responses that are not problem details still become an *Error carrying the status
+	apiError := &Error{}
+	if err := json.Unmarshal(body, apiError); err != nil || apiError.Detail == "" {
+		apiError.Detail = http.StatusText(response.StatusCode)
+	}
+	apiError.StatusCode = response.StatusCode
+	if apiError.RequestId == "" {
+		apiError.RequestId = response.Header.Get("X-Request-ID")
+	}
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiError
+}
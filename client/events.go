@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AnyVersion passed as the ETag changes the event whatever its current version is, possibly undoing someone else's change
+const AnyVersion = "*"
+
+var errNoETag = errors.New("client: an ETag is required, pass the one the event was read with or AnyVersion")
+
+func (c *Client) ListEvents(ctx context.Context) ([]Event, error) {
+	var events []Event
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/v2/events/", authenticated: true, retryable: true}, &events)
+	return events, err
+}
+
+func (c *Client) GetEvent(ctx context.Context, eventId int64) (*Event, error) {
+	var event Event
+	headers, err := c.do(ctx, request{method: http.MethodGet, path: eventPath(eventId), authenticated: true, retryable: true}, &event)
+	if err != nil {
+		return nil, err
+	}
+	event.ETag = headers.Get("ETag")
+	return &event, nil
+}
+
+func (c *Client) CreateEvent(ctx context.Context, event NewEvent) (*Event, error) {
+	var response struct {
+		Event Event `json:"event"`
+	}
+	headers, err := c.do(ctx, request{
+		method:        http.MethodPost,
+		path:          "/v2/events/",
+		body:          event,
+		headers:       map[string]string{"Idempotency-Key": newIdempotencyKey()},
+		authenticated: true,
+		retryable:     true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	response.Event.ETag = headers.Get("ETag")
+	return &response.Event, nil
+}
+
+// UpdateEvent applies the changes if the event is still at the version named by etag
+func (c *Client) UpdateEvent(ctx context.Context, eventId int64, etag string, changes EventChanges) (*Event, error) {
+	if etag == "" {
+		return nil, errNoETag
+	}
+	var response struct {
+		Event Event `json:"event"`
+	}
+	headers, err := c.do(ctx, request{
+		method:        http.MethodPatch,
+		path:          eventPath(eventId),
+		body:          changes,
+		contentType:   "application/merge-patch+json",
+		headers:       map[string]string{"If-Match": etag},
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	response.Event.ETag = headers.Get("ETag")
+	return &response.Event, nil
+}
+
+// DeleteEvent deletes the event if it is still at the version named by etag, and refunds its attendees
+func (c *Client) DeleteEvent(ctx context.Context, eventId int64, etag string) ([]Refund, error) {
+	if etag == "" {
+		return nil, errNoETag
+	}
+	var response struct {
+		Refunds []Refund `json:"refunds"`
+	}
+	_, err := c.do(ctx, request{
+		method:        http.MethodDelete,
+		path:          eventPath(eventId),
+		headers:       map[string]string{"If-Match": etag},
+		authenticated: true,
+	}, &response)
+	return response.Refunds, err
+}
+
+// RegisterForEvent registers the logged in user and returns the registration with its signed ticket
+func (c *Client) RegisterForEvent(ctx context.Context, eventId int64, choices RegistrationRequest) (*Registration, string, error) {
+	var response struct {
+		Registration Registration `json:"registration"`
+		Ticket       string       `json:"ticket"`
+	}
+	_, err := c.do(ctx, request{
+		method:        http.MethodPost,
+		path:          eventPath(eventId) + "/registration",
+		body:          choices,
+		headers:       map[string]string{"Idempotency-Key": newIdempotencyKey()},
+		authenticated: true,
+		retryable:     true,
+	}, &response)
+	if err != nil {
+		return nil, "", err
+	}
+	return &response.Registration, response.Ticket, nil
+}
+
+// CancelRegistration returns the refund issued for the cancelled registration, if any
+func (c *Client) CancelRegistration(ctx context.Context, eventId int64) (*Refund, error) {
+	var response struct {
+		Refund *Refund `json:"refund"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: eventPath(eventId) + "/registration", authenticated: true}, &response)
+	return response.Refund, err
+}
+
+func (c *Client) CheckIn(ctx context.Context, eventId int64, ticket string) (*Registration, error) {
+	var response struct {
+		Registration Registration `json:"registration"`
+	}
+	body := map[string]string{"ticket": ticket}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: eventPath(eventId) + "/check-in", body: body, authenticated: true}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response.Registration, nil
+}
+
+// SetCancellationPolicy replaces the policy if the event is still at the version named by etag
+func (c *Client) SetCancellationPolicy(ctx context.Context, eventId int64, etag string, policy CancellationPolicy) (*Event, error) {
+	if etag == "" {
+		return nil, errNoETag
+	}
+	var response struct {
+		Event Event `json:"event"`
+	}
+	headers, err := c.do(ctx, request{
+		method:        http.MethodPut,
+		path:          eventPath(eventId) + "/cancellation-policy",
+		body:          policy,
+		headers:       map[string]string{"If-Match": etag},
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	response.Event.ETag = headers.Get("ETag")
+	return &response.Event, nil
+}
+
+func (c *Client) ListRefunds(ctx context.Context, eventId int64) ([]Refund, error) {
+	var refunds []Refund
+	_, err := c.do(ctx, request{method: http.MethodGet, path: eventPath(eventId) + "/refunds", authenticated: true, retryable: true}, &refunds)
+	return refunds, err
+}
+
+func (c *Client) ListTicketTypes(ctx context.Context, eventId int64) ([]TicketType, error) {
+	var ticketTypes []TicketType
+	_, err := c.do(ctx, request{method: http.MethodGet, path: eventPath(eventId) + "/ticket-types", authenticated: true, retryable: true}, &ticketTypes)
+	return ticketTypes, err
+}
+
+func (c *Client) CreateTicketType(ctx context.Context, eventId int64, name string, price int64) (*TicketType, error) {
+	var response struct {
+		TicketType TicketType `json:"ticketType"`
+	}
+	body := map[string]any{"name": name, "price": price}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: eventPath(eventId) + "/ticket-types", body: body, authenticated: true}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response.TicketType, nil
+}
+
+func (c *Client) ListDiscountCodes(ctx context.Context, eventId int64) ([]DiscountCode, error) {
+	var codes []DiscountCode
+	_, err := c.do(ctx, request{method: http.MethodGet, path: eventPath(eventId) + "/discount-codes", authenticated: true, retryable: true}, &codes)
+	return codes, err
+}
+
+// CreateDiscountCode creates the code, the Id, EventId, UsedCount and CreatedAt fields of the argument are ignored
+func (c *Client) CreateDiscountCode(ctx context.Context, eventId int64, code DiscountCode) (*DiscountCode, error) {
+	var response struct {
+		DiscountCode DiscountCode `json:"discountCode"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: eventPath(eventId) + "/discount-codes", body: code, authenticated: true}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response.DiscountCode, nil
+}
+
+func eventPath(eventId int64) string {
+	return fmt.Sprintf("/v2/events/%d", eventId)
+}
@@ -0,0 +1,98 @@
+package client
+
+import "time"
+
+// The types below mirror the v2 JSON documents of the API as described in openapi/openapi.json.
+// They are kept separate from the models package so callers do not pull in the database drivers.
+// TestTypesMatchAPI compares their JSON members with the dto types the API serves, so they cannot drift apart.
+
+type Event struct {
+	Id                 int64               `json:"id"`
+	Title              string              `json:"title"`
+	Description        string              `json:"description"`
+	Location           string              `json:"location"`
+	StartTime          time.Time           `json:"startTime"`
+	EndTime            time.Time           `json:"endTime"`
+	OrganizerId        int64               `json:"organizerId"`
+	AttendeeIds        []int64             `json:"attendeeIds"`
+	Price              int64               `json:"price"`
+	CancellationPolicy *CancellationPolicy `json:"cancellationPolicy,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	UpdatedAt          *time.Time          `json:"updatedAt,omitempty"`
+	ETag               string              `json:"-"` // Version the event was read at, pass it back to UpdateEvent and DeleteEvent
+}
+
+// NewEvent holds the fields sent to create an event
+type NewEvent struct {
+	Title              string              `json:"title"`
+	Description        string              `json:"description,omitempty"`
+	Location           string              `json:"location,omitempty"`
+	StartTime          time.Time           `json:"startTime"`
+	EndTime            time.Time           `json:"endTime"`
+	Price              int64               `json:"price,omitempty"`
+	CancellationPolicy *CancellationPolicy `json:"cancellationPolicy,omitempty"`
+}
+
+// EventChanges is a merge patch, nil fields are left unchanged
+type EventChanges struct {
+	Title       *string    `json:"title,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	Location    *string    `json:"location,omitempty"`
+	StartTime   *time.Time `json:"startTime,omitempty"`
+	EndTime     *time.Time `json:"endTime,omitempty"`
+	Price       *int64     `json:"price,omitempty"`
+}
+
+type CancellationPolicy struct {
+	FullRefundDays       int64 `json:"fullRefundDays"`
+	PartialRefundDays    int64 `json:"partialRefundDays"`
+	PartialRefundPercent int64 `json:"partialRefundPercent"`
+}
+
+type Registration struct {
+	EventId        int64      `json:"eventId"`
+	UserId         int64      `json:"userId"`
+	AmountPaid     int64      `json:"amountPaid"`
+	TicketTypeId   *int64     `json:"ticketTypeId,omitempty"`
+	DiscountCodeId *int64     `json:"discountCodeId,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	CheckedInAt    *time.Time `json:"checkedInAt,omitempty"`
+}
+
+// RegistrationRequest holds the optional choices made when registering
+type RegistrationRequest struct {
+	TicketTypeId *int64 `json:"ticketTypeId,omitempty"`
+	DiscountCode string `json:"discountCode,omitempty"`
+}
+
+type Refund struct {
+	Id        int64     `json:"id"`
+	EventId   int64     `json:"eventId"`
+	UserId    int64     `json:"userId"`
+	Amount    int64     `json:"amount"`
+	Reason    string    `json:"reason"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TicketType struct {
+	Id        int64     `json:"id"`
+	EventId   int64     `json:"eventId"`
+	Name      string    `json:"name"`
+	Price     int64     `json:"price"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type DiscountCode struct {
+	Id            int64      `json:"id,omitempty"`
+	EventId       int64      `json:"eventId,omitempty"`
+	Code          string     `json:"code"`
+	Kind          string     `json:"kind"`
+	Value         int64      `json:"value"`
+	MaxUses       int64      `json:"maxUses"`
+	UsedCount     int64      `json:"usedCount,omitempty"`
+	ValidFrom     *time.Time `json:"validFrom,omitempty"`
+	ValidUntil    *time.Time `json:"validUntil,omitempty"`
+	TicketTypeIds []int64    `json:"ticketTypeIds,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt,omitzero"`
+}
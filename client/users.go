@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+func (c *Client) Signup(ctx context.Context, email, password string) error {
+	body := map[string]string{"email": email, "password": password}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v2/signup", body: body}, nil)
+	return err
+}
+
+// Login checks the credentials and keeps them to renew the token when it expires
+func (c *Client) Login(ctx context.Context, email, password string) (string, error) {
+	token, err := c.login(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.email = email
+	c.password = password
+	c.token = token
+	c.expiry = tokenExpiry(token)
+	return token, nil
+}
+
+func (c *Client) login(ctx context.Context, email, password string) (string, error) {
+	body := map[string]string{"email": email, "password": password}
+	var response struct {
+		Token string `json:"token"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v2/login", body: body, retryable: true}, &response)
+	return response.Token, err
+}
+
+// Logout revokes the current token and forgets the credentials, later calls fail until Login is called again
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v2/logout", authenticated: true}, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.email = ""
+	c.password = ""
+	c.token = ""
+	c.expiry = time.Time{}
+	return nil
+}
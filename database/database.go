@@ -1,16 +1,40 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
 
-	_ "modernc.org/sqlite"
+	"github.com/XSAM/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 var DB *sql.DB
 
-func InitDB() {
+var migrated atomic.Bool // Set once the schema is fully created and migrated
+
+const defaultPath = "booking.db"
+
+func Path() string {
+	// Returns the database file to open, DATABASE_PATH overrides the default booking.db
+	if path := os.Getenv("DATABASE_PATH"); path != "" {
+		return path
+	}
+	return defaultPath
+}
+
+func InitDB(path string) {
 	var err error
-	DB, err = sql.Open("sqlite", "booking.db")
+	// Every statement is traced as a child span of the request that issued it
+	DB, err = otelsql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate", // Wait on locks instead of failing concurrent writes
+		otelsql.WithAttributes(semconv.DBSystemNameSqlite),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 
 	if err != nil {
 		panic("Failed to connect to database: " + err.Error())
@@ -20,6 +44,22 @@ func InitDB() {
 	DB.SetMaxIdleConns(5)
 
 	createTables()
+	migrateColumns()
+	migrated.Store(true)
+}
+
+func CheckConnection(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	return DB.PingContext(ctx)
+}
+
+func CheckMigrations(ctx context.Context) error {
+	if !migrated.Load() {
+		return errors.New("migrations have not been applied")
+	}
+	return nil
 }
 
 func createTables() {
@@ -28,6 +68,7 @@ func createTables() {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		password TEXT NOT NULL,
 		email TEXT NOT NULL UNIQUE,
+		calendar_token TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME,
 		deleted_at DATETIME
@@ -44,16 +85,112 @@ func createTables() {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME,
 		deleted_at DATETIME,
+		price INTEGER NOT NULL DEFAULT 0,
+		sequence INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
 		FOREIGN KEY (organizer) REFERENCES users(id)
 	);`
 	createAttendeeTable := `
 	CREATE TABLE IF NOT EXISTS event_attendees (
 		event_id INTEGER,
 		user_id INTEGER,
+		amount_paid INTEGER NOT NULL DEFAULT 0,
+		ticket_type_id INTEGER,
+		discount_code_id INTEGER,
+		created_at DATETIME,
+		checked_in_at DATETIME,
 		PRIMARY KEY (event_id, user_id),
 		FOREIGN KEY (event_id) REFERENCES events(id),
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);`
+	createCancellationPoliciesTable := `
+	CREATE TABLE IF NOT EXISTS cancellation_policies (
+		event_id INTEGER PRIMARY KEY,
+		full_refund_days INTEGER NOT NULL DEFAULT 0,
+		partial_refund_days INTEGER NOT NULL DEFAULT 0,
+		partial_refund_percent INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (event_id) REFERENCES events(id)
+	);`
+	createRefundsTable := `
+	CREATE TABLE IF NOT EXISTS refunds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		amount INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		status TEXT NOT NULL,
+		provider_reference TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME,
+		FOREIGN KEY (event_id) REFERENCES events(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	createTicketTypesTable := `
+	CREATE TABLE IF NOT EXISTS ticket_types (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		price INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (event_id) REFERENCES events(id)
+	);`
+	createDiscountCodesTable := `
+	CREATE TABLE IF NOT EXISTS discount_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		code TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		value INTEGER NOT NULL,
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		used_count INTEGER NOT NULL DEFAULT 0,
+		valid_from DATETIME,
+		valid_until DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (event_id, code),
+		FOREIGN KEY (event_id) REFERENCES events(id)
+	);`
+	createDiscountCodeTicketTypesTable := `
+	CREATE TABLE IF NOT EXISTS discount_code_ticket_types (
+		discount_code_id INTEGER,
+		ticket_type_id INTEGER,
+		PRIMARY KEY (discount_code_id, ticket_type_id),
+		FOREIGN KEY (discount_code_id) REFERENCES discount_codes(id),
+		FOREIGN KEY (ticket_type_id) REFERENCES ticket_types(id)
+	);`
+	createIdempotencyKeysTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT,
+		body BLOB,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (user_id, key),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+	createSigningKeysTable := `
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		id TEXT PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		private_key BLOB NOT NULL,
+		encrypted INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		activates_at DATETIME NOT NULL
+	);`
+	createRevokedTokensTable := `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		id TEXT PRIMARY KEY,
+		expires_at DATETIME NOT NULL
+	);`
+	createTicketSecretsTable := `
+	CREATE TABLE IF NOT EXISTS ticket_secrets (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		secret BLOB NOT NULL,
+		created_at DATETIME NOT NULL
+	);`
 
 	_, usersTableErr := DB.Exec(createUsersTable)
 	if usersTableErr != nil {
@@ -67,4 +204,96 @@ func createTables() {
 	if attendeesTableErr != nil {
 		panic("Failed to create event_attendees table: " + attendeesTableErr.Error())
 	}
+	_, cancellationPoliciesTableErr := DB.Exec(createCancellationPoliciesTable)
+	if cancellationPoliciesTableErr != nil {
+		panic("Failed to create cancellation_policies table: " + cancellationPoliciesTableErr.Error())
+	}
+	_, refundsTableErr := DB.Exec(createRefundsTable)
+	if refundsTableErr != nil {
+		panic("Failed to create refunds table: " + refundsTableErr.Error())
+	}
+	_, ticketTypesTableErr := DB.Exec(createTicketTypesTable)
+	if ticketTypesTableErr != nil {
+		panic("Failed to create ticket_types table: " + ticketTypesTableErr.Error())
+	}
+	_, discountCodesTableErr := DB.Exec(createDiscountCodesTable)
+	if discountCodesTableErr != nil {
+		panic("Failed to create discount_codes table: " + discountCodesTableErr.Error())
+	}
+	_, discountCodeTicketTypesTableErr := DB.Exec(createDiscountCodeTicketTypesTable)
+	if discountCodeTicketTypesTableErr != nil {
+		panic("Failed to create discount_code_ticket_types table: " + discountCodeTicketTypesTableErr.Error())
+	}
+	_, idempotencyKeysTableErr := DB.Exec(createIdempotencyKeysTable)
+	if idempotencyKeysTableErr != nil {
+		panic("Failed to create idempotency_keys table: " + idempotencyKeysTableErr.Error())
+	}
+	_, signingKeysTableErr := DB.Exec(createSigningKeysTable)
+	if signingKeysTableErr != nil {
+		panic("Failed to create signing_keys table: " + signingKeysTableErr.Error())
+	}
+	_, revokedTokensTableErr := DB.Exec(createRevokedTokensTable)
+	if revokedTokensTableErr != nil {
+		panic("Failed to create revoked_tokens table: " + revokedTokensTableErr.Error())
+	}
+	_, ticketSecretsTableErr := DB.Exec(createTicketSecretsTable)
+	if ticketSecretsTableErr != nil {
+		panic("Failed to create ticket_secrets table: " + ticketSecretsTableErr.Error())
+	}
+}
+
+func migrateColumns() {
+	// Columns added after the initial schema, applied to databases created before they existed
+	addColumnIfMissing("events", "price", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("events", "sequence", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("events", "version", "INTEGER NOT NULL DEFAULT 1")
+	addColumnIfMissing("users", "calendar_token", "TEXT")
+	addColumnIfMissing("event_attendees", "amount_paid", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("event_attendees", "created_at", "DATETIME")
+	addColumnIfMissing("event_attendees", "ticket_type_id", "INTEGER")
+	addColumnIfMissing("event_attendees", "discount_code_id", "INTEGER")
+	addColumnIfMissing("event_attendees", "checked_in_at", "DATETIME")
+	addColumnIfMissing("refunds", "attempts", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("refunds", "updated_at", "DATETIME")
+	addColumnIfMissing("signing_keys", "encrypted", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func addColumnIfMissing(table, column, definition string) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		panic("Failed to inspect " + table + " table: " + err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      int
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			panic("Failed to inspect " + table + " table: " + err.Error())
+		}
+		if name == column {
+			return
+		}
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		panic("Failed to add " + column + " column to " + table + " table: " + err.Error())
+	}
+}
+
+// IsUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
 }
@@ -0,0 +1,121 @@
+// Package dto holds the request and response documents of the API, kept apart from the models so storage
+// changes do not change the wire format. Requests are mapped to models with Model, and the models are validated
+// as before: only rules about the request itself, like the password policy at signup, are declared here.
+// Responses are built from models by the From functions and only expose what clients need, v1 still
+// serializes the models directly so its clients see no change.
+package dto
+
+import (
+	"time"
+
+	"github.com/ftilie/go-booking-api/models"
+)
+
+// Event is an event as returned by the API, its version is sent in the ETag header
+type Event struct {
+	Id                 int64               `json:"id"`
+	Title              string              `json:"title"`
+	Description        string              `json:"description"`
+	Location           string              `json:"location"`
+	StartTime          time.Time           `json:"startTime"`
+	EndTime            time.Time           `json:"endTime"`
+	OrganizerId        int64               `json:"organizerId"`
+	AttendeeIds        []int64             `json:"attendeeIds"`
+	Price              int64               `json:"price"`
+	CancellationPolicy *CancellationPolicy `json:"cancellationPolicy,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt"`
+	UpdatedAt          *time.Time          `json:"updatedAt,omitempty"`
+}
+
+// NewEvent holds the fields a client sets when creating an event
+type NewEvent struct {
+	Title              string              `json:"title"`
+	Description        string              `json:"description"`
+	Location           string              `json:"location"`
+	StartTime          time.Time           `json:"startTime"`
+	EndTime            time.Time           `json:"endTime"`
+	Price              int64               `json:"price"`
+	CancellationPolicy *CancellationPolicy `json:"cancellationPolicy"`
+}
+
+// ImportRow reports one row of an imported file
+type ImportRow struct {
+	Row    int      `json:"row"`
+	Event  Event    `json:"event"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type CancellationPolicy struct {
+	FullRefundDays       int64 `json:"fullRefundDays"`
+	PartialRefundDays    int64 `json:"partialRefundDays"`
+	PartialRefundPercent int64 `json:"partialRefundPercent"`
+}
+
+func FromEvent(event models.Event) Event {
+	attendees := event.Attendees
+	if attendees == nil {
+		attendees = []int64{}
+	}
+	return Event{
+		Id:                 event.Id,
+		Title:              event.Title,
+		Description:        event.Description,
+		Location:           event.Location,
+		StartTime:          event.StartTime,
+		EndTime:            event.EndTime,
+		OrganizerId:        event.Organizer,
+		AttendeeIds:        attendees,
+		Price:              event.Price,
+		CancellationPolicy: FromCancellationPolicy(event.CancellationPolicy),
+		CreatedAt:          event.CreatedAt,
+		UpdatedAt:          event.UpdatedAt,
+	}
+}
+
+func FromEvents(events []models.Event) []Event {
+	return mapAll(events, FromEvent)
+}
+
+func (e NewEvent) Model() models.Event {
+	event := models.Event{
+		Title:       e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		StartTime:   e.StartTime,
+		EndTime:     e.EndTime,
+		Price:       e.Price,
+	}
+	if e.CancellationPolicy != nil {
+		policy := e.CancellationPolicy.Model()
+		event.CancellationPolicy = &policy
+	}
+	return event
+}
+
+func FromCancellationPolicy(policy *models.CancellationPolicy) *CancellationPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &CancellationPolicy{
+		FullRefundDays:       policy.FullRefundDays,
+		PartialRefundDays:    policy.PartialRefundDays,
+		PartialRefundPercent: policy.PartialRefundPercent,
+	}
+}
+
+func (p CancellationPolicy) Model() models.CancellationPolicy {
+	return models.CancellationPolicy{
+		FullRefundDays:       p.FullRefundDays,
+		PartialRefundDays:    p.PartialRefundDays,
+		PartialRefundPercent: p.PartialRefundPercent,
+	}
+}
+
+func mapAll[M, D any](values []M, from func(M) D) []D {
+	// Lists are never null in responses
+	documents := make([]D, 0, len(values))
+	for _, value := range values {
+		documents = append(documents, from(value))
+	}
+	return documents
+}
@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ftilie/go-booking-api/models"
+)
+
+type Registration struct {
+	EventId        int64      `json:"eventId"`
+	UserId         int64      `json:"userId"`
+	AmountPaid     int64      `json:"amountPaid"`
+	TicketTypeId   *int64     `json:"ticketTypeId,omitempty"`
+	DiscountCodeId *int64     `json:"discountCodeId,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	CheckedInAt    *time.Time `json:"checkedInAt,omitempty"`
+}
+
+// RegistrationRequest holds the optional choices an attendee makes when registering
+type RegistrationRequest struct {
+	TicketTypeId *int64 `json:"ticketTypeId"`
+	DiscountCode string `json:"discountCode"`
+}
+
+type CheckIn struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
+
+// Refund is a refund as returned by the API, the payment provider's reference stays internal
+type Refund struct {
+	Id        int64     `json:"id"`
+	EventId   int64     `json:"eventId"`
+	UserId    int64     `json:"userId"`
+	Amount    int64     `json:"amount"`
+	Reason    string    `json:"reason"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func FromRegistration(registration models.Registration) Registration {
+	return Registration{
+		EventId:        registration.EventId,
+		UserId:         registration.UserId,
+		AmountPaid:     registration.AmountPaid,
+		TicketTypeId:   registration.TicketTypeId,
+		DiscountCodeId: registration.DiscountCodeId,
+		CreatedAt:      registration.CreatedAt,
+		CheckedInAt:    registration.CheckedInAt,
+	}
+}
+
+func (r RegistrationRequest) Model() models.RegistrationRequest {
+	return models.RegistrationRequest{TicketTypeId: r.TicketTypeId, DiscountCode: r.DiscountCode}
+}
+
+func FromRefund(refund models.Refund) Refund {
+	return Refund{
+		Id:        refund.Id,
+		EventId:   refund.EventId,
+		UserId:    refund.UserId,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		Status:    refund.Status,
+		CreatedAt: refund.CreatedAt,
+	}
+}
+
+func FromRefunds(refunds []models.Refund) []Refund {
+	return mapAll(refunds, FromRefund)
+}
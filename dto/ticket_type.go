@@ -0,0 +1,98 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ftilie/go-booking-api/models"
+)
+
+type TicketType struct {
+	Id        int64     `json:"id"`
+	EventId   int64     `json:"eventId"`
+	Name      string    `json:"name"`
+	Price     int64     `json:"price"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NewTicketType struct {
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+type DiscountCode struct {
+	Id            int64      `json:"id"`
+	EventId       int64      `json:"eventId"`
+	Code          string     `json:"code"`
+	Kind          string     `json:"kind"`
+	Value         int64      `json:"value"`
+	MaxUses       int64      `json:"maxUses"`
+	UsedCount     int64      `json:"usedCount"`
+	ValidFrom     *time.Time `json:"validFrom,omitempty"`
+	ValidUntil    *time.Time `json:"validUntil,omitempty"`
+	TicketTypeIds []int64    `json:"ticketTypeIds"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+type NewDiscountCode struct {
+	Code          string     `json:"code"`
+	Kind          string     `json:"kind"`
+	Value         int64      `json:"value"`
+	MaxUses       int64      `json:"maxUses"`
+	ValidFrom     *time.Time `json:"validFrom"`
+	ValidUntil    *time.Time `json:"validUntil"`
+	TicketTypeIds []int64    `json:"ticketTypeIds"`
+}
+
+func FromTicketType(ticketType models.TicketType) TicketType {
+	return TicketType{
+		Id:        ticketType.Id,
+		EventId:   ticketType.EventId,
+		Name:      ticketType.Name,
+		Price:     ticketType.Price,
+		CreatedAt: ticketType.CreatedAt,
+	}
+}
+
+func FromTicketTypes(ticketTypes []models.TicketType) []TicketType {
+	return mapAll(ticketTypes, FromTicketType)
+}
+
+func (t NewTicketType) Model() models.TicketType {
+	return models.TicketType{Name: t.Name, Price: t.Price}
+}
+
+func FromDiscountCode(code models.DiscountCode) DiscountCode {
+	ticketTypeIds := code.TicketTypeIds
+	if ticketTypeIds == nil {
+		ticketTypeIds = []int64{}
+	}
+	return DiscountCode{
+		Id:            code.Id,
+		EventId:       code.EventId,
+		Code:          code.Code,
+		Kind:          code.Kind,
+		Value:         code.Value,
+		MaxUses:       code.MaxUses,
+		UsedCount:     code.UsedCount,
+		ValidFrom:     code.ValidFrom,
+		ValidUntil:    code.ValidUntil,
+		TicketTypeIds: ticketTypeIds,
+		CreatedAt:     code.CreatedAt,
+	}
+}
+
+func FromDiscountCodes(codes []models.DiscountCode) []DiscountCode {
+	return mapAll(codes, FromDiscountCode)
+}
+
+func (c NewDiscountCode) Model() models.DiscountCode {
+	return models.DiscountCode{
+		Code:          c.Code,
+		Kind:          c.Kind,
+		Value:         c.Value,
+		MaxUses:       c.MaxUses,
+		ValidFrom:     c.ValidFrom,
+		ValidUntil:    c.ValidUntil,
+		TicketTypeIds: c.TicketTypeIds,
+	}
+}
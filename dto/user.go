@@ -0,0 +1,22 @@
+package dto
+
+import "github.com/ftilie/go-booking-api/models"
+
+// Signing up enforces the password policy, logging in does not so older passwords keep working
+type Signup struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (s Signup) Model() models.User {
+	return models.User{Email: s.Email, Password: s.Password}
+}
+
+func (c Credentials) Model() models.User {
+	return models.User{Email: c.Email, Password: c.Password}
+}
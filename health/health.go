@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errWorkerStopped = errors.New("worker is not running")
+
+// A Check reports whether a dependency or background worker is ready to serve traffic
+type Check func(ctx context.Context) error
+
+const checkTimeout = 2 * time.Second
+
+var (
+	mutex  sync.RWMutex
+	checks = map[string]Check{}
+)
+
+func Register(name string, check Check) {
+	// This function will add a check to the readiness probe, registering a name again replaces its check
+	mutex.Lock()
+	defer mutex.Unlock()
+	checks[name] = check
+}
+
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func Run(ctx context.Context) ([]Result, bool) {
+	// This function will run every registered check and report whether all of them passed
+	mutex.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	registered := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		registered[name] = check
+	}
+	mutex.RUnlock()
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]Result, 0, len(names))
+	ready := true
+	for _, name := range names {
+		result := Result{Name: name, Status: "ok"}
+		if err := registered[name](ctx); err != nil {
+			result.Status = "failing"
+			result.Error = err.Error()
+			ready = false
+		}
+		results = append(results, result)
+	}
+	return results, ready
+}
+
+// Worker tracks whether a background worker is running, for use as a readiness check
+type Worker struct {
+	mutex   sync.Mutex
+	running bool
+}
+
+func (w *Worker) SetRunning(running bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.running = running
+}
+
+func (w *Worker) Check(ctx context.Context) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.running {
+		return errWorkerStopped
+	}
+	return nil
+}
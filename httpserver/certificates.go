@@ -0,0 +1,110 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ftilie/go-booking-api/logger"
+)
+
+// reloadInterval is how often the certificate files are checked for changes, at most once per handshake
+const reloadInterval = 30 * time.Second
+
+// certificateReloader serves a certificate and client CA pool that are loaded again whenever their files change,
+// so renewed certificates are picked up without a restart
+type certificateReloader struct {
+	certFile, keyFile, clientCAFile string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modified    time.Time // Latest modification time of the files that were loaded
+	lastCheck   time.Time
+	now         func() time.Time
+}
+
+func newCertificateReloader(certFile, keyFile, clientCAFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile, now: time.Now}
+	modified, err := reloader.modifiedAt()
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.load(modified); err != nil {
+		return nil, err
+	}
+	reloader.lastCheck = reloader.now()
+	return reloader, nil
+}
+
+func (r *certificateReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *certificateReloader) modifiedAt() (time.Time, error) {
+	var latest time.Time
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certificateReloader) load(modified time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in " + r.clientCAFile)
+		}
+	}
+	r.certificate, r.clientCAs, r.modified = &certificate, clientCAs, modified
+	return nil
+}
+
+func (r *certificateReloader) current() (*tls.Certificate, *x509.CertPool) {
+	// Returns the loaded certificate and client CAs, loading them again first when the files changed.
+	// A file caught half written fails to load, the previous certificate is kept and the next check retries.
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	if now.Sub(r.lastCheck) < reloadInterval {
+		return r.certificate, r.clientCAs
+	}
+	r.lastCheck = now
+
+	modified, err := r.modifiedAt()
+	if err == nil && modified.Equal(r.modified) {
+		return r.certificate, r.clientCAs
+	}
+	if err == nil {
+		err = r.load(modified)
+	}
+	if err != nil {
+		logger.Log.Warn("failed to reload the TLS certificate, serving the previous one", "error", err)
+		return r.certificate, r.clientCAs
+	}
+	logger.Log.Info("reloaded the TLS certificate", "file", r.certFile)
+	return r.certificate, r.clientCAs
+}
@@ -0,0 +1,126 @@
+// Package httpserver runs the API over plain HTTP or HTTPS, as configured by the environment.
+// HTTPS serves HTTP/2 as well, and plain HTTP can serve HTTP/2 without TLS (h2c) to a proxy that speaks it.
+package httpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAddress    = ":8080"
+	readHeaderTimeout = 10 * time.Second // Drops clients that open connections without ever finishing a request
+)
+
+// Config describes how the server listens, leaving CertFile empty serves plain HTTP
+type Config struct {
+	Address           string
+	CertFile          string // PEM certificate chain, reloaded when the file changes
+	KeyFile           string // PEM private key of the certificate
+	ClientCAFile      string // PEM CAs client certificates are verified against, enables mutual TLS
+	RequireClientCert bool   // Refuse clients without a certificate instead of only verifying the ones sent
+	H2C               bool   // Accept HTTP/2 without TLS, for proxies that terminate TLS and speak HTTP/2 upstream
+}
+
+func (c Config) TLS() bool {
+	return c.CertFile != ""
+}
+
+func ConfigFromEnv() (Config, error) {
+	// Returns the configuration set by ADDRESS, TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE, TLS_CLIENT_AUTH and H2C
+	config := Config{
+		Address:      os.Getenv("ADDRESS"),
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+	if config.Address == "" {
+		config.Address = defaultAddress
+	}
+
+	switch os.Getenv("TLS_CLIENT_AUTH") {
+	case "", "optional":
+	case "require":
+		config.RequireClientCert = true
+	default:
+		return Config{}, errors.New("TLS_CLIENT_AUTH must be optional or require")
+	}
+	if value := os.Getenv("H2C"); value != "" {
+		h2c, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, errors.New("H2C must be true or false")
+		}
+		config.H2C = h2c
+	}
+
+	switch {
+	case (config.CertFile == "") != (config.KeyFile == ""):
+		return Config{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case config.ClientCAFile != "" && !config.TLS():
+		return Config{}, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	case config.RequireClientCert && config.ClientCAFile == "":
+		return Config{}, errors.New("TLS_CLIENT_AUTH=require needs TLS_CLIENT_CA_FILE")
+	case config.H2C && config.TLS():
+		return Config{}, errors.New("H2C only applies to plain HTTP, HTTPS already serves HTTP/2")
+	}
+	return config, nil
+}
+
+func New(config Config, handler http.Handler) (*http.Server, error) {
+	// This function will build the server for the configuration, loading the certificates when TLS is enabled
+	server := &http.Server{Addr: config.Address, Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+
+	if config.H2C {
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = &protocols
+	}
+	if !config.TLS() {
+		return server, nil
+	}
+
+	reloader, err := newCertificateReloader(config.CertFile, config.KeyFile, config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if config.ClientCAFile != "" {
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCert {
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	server.TLSConfig = &tls.Config{
+		MinVersion: base.MinVersion,
+		NextProtos: base.NextProtos,
+		// Every handshake gets the certificate and client CAs as currently found on disk
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			certificate, clientCAs := reloader.current()
+			config := base.Clone()
+			config.Certificates = []tls.Certificate{*certificate}
+			config.ClientCAs = clientCAs
+			return config, nil
+		},
+	}
+	return server, nil
+}
+
+func ListenAndServe(config Config, handler http.Handler) error {
+	// This function will serve the handler until the server fails
+	server, err := New(config, handler)
+	if err != nil {
+		return err
+	}
+	if config.TLS() {
+		return server.ListenAndServeTLS("", "") // The certificates come from TLSConfig
+	}
+	return server.ListenAndServe()
+}
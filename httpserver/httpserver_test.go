@@ -0,0 +1,278 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// authority is a test CA issuing server and client certificates
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pool        *x509.CertPool
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &authority{certificate: certificate, key: key, pool: pool}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// issue returns the PEM certificate and key of a new leaf certificate named name
+func (a *authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key := newKey(t)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func (a *authority) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.certificate.Raw})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modified time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts the server on a random local port and returns its address
+func serve(t *testing.T, config Config) string {
+	t.Helper()
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Protocol", request.Proto)
+		if request.TLS != nil && len(request.TLS.PeerCertificates) > 0 {
+			writer.Header().Set("X-Client", request.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	})
+	server, err := New(config, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if config.TLS() {
+			server.ServeTLS(listener, "", "")
+		} else {
+			server.Serve(listener)
+		}
+	}()
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func get(client *http.Client, url string) (*http.Response, error) {
+	response, err := client.Get(url)
+	if err == nil {
+		response.Body.Close()
+	}
+	return response, err
+}
+
+func TestTLS(t *testing.T) {
+	ca := newAuthority(t)
+	directory := t.TempDir()
+	config := Config{CertFile: filepath.Join(directory, "cert.pem"), KeyFile: filepath.Join(directory, "key.pem")}
+	certificate, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.CertFile, certificate, time.Now())
+	writeFile(t, config.KeyFile, key, time.Now())
+
+	address := serve(t, config)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}, ForceAttemptHTTP2: true}}
+	response, err := get(client, "https://"+address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.Get("X-Protocol") != "HTTP/2.0" {
+		t.Errorf("served over %s, want HTTP/2.0", response.Header.Get("X-Protocol"))
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newAuthority(t)
+	directory := t.TempDir()
+	config := Config{
+		CertFile:          filepath.Join(directory, "cert.pem"),
+		KeyFile:           filepath.Join(directory, "key.pem"),
+		ClientCAFile:      filepath.Join(directory, "ca.pem"),
+		RequireClientCert: true,
+	}
+	certificate, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.CertFile, certificate, time.Now())
+	writeFile(t, config.KeyFile, key, time.Now())
+	writeFile(t, config.ClientCAFile, ca.pem(), time.Now())
+	address := serve(t, config)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}}
+	if _, err := get(anonymous, "https://"+address); err == nil {
+		t.Error("a client without certificate was served")
+	}
+
+	clientCertificate, clientKey := ca.issue(t, "billing", x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCertificate, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{pair}}}}
+	response, err := get(internal, "https://"+address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.Get("X-Client") != "billing" {
+		t.Errorf("client certificate %q, want billing", response.Header.Get("X-Client"))
+	}
+}
+
+func TestH2C(t *testing.T) {
+	address := serve(t, Config{H2C: true})
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	response, err := get(client, "http://"+address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.Get("X-Protocol") != "HTTP/2.0" {
+		t.Errorf("served over %s, want HTTP/2.0", response.Header.Get("X-Protocol"))
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	ca := newAuthority(t)
+	directory := t.TempDir()
+	certFile, keyFile := filepath.Join(directory, "cert.pem"), filepath.Join(directory, "key.pem")
+	written := time.Now().Add(-time.Hour)
+	certificate, key := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certificate, written)
+	writeFile(t, keyFile, key, written)
+
+	reloader, err := newCertificateReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	commonName := func() string {
+		current, _ := reloader.current()
+		return current.Leaf.Subject.CommonName
+	}
+
+	certificate, key = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certificate, written.Add(time.Minute))
+	if name := commonName(); name != "first" {
+		t.Errorf("serving %q before the reload interval, want first", name)
+	}
+
+	// The key no longer matches the new certificate until it is written too
+	now = now.Add(reloadInterval)
+	if name := commonName(); name != "first" {
+		t.Errorf("serving %q while the key is outdated, want first", name)
+	}
+
+	writeFile(t, keyFile, key, written.Add(time.Minute))
+	now = now.Add(reloadInterval)
+	if name := commonName(); name != "second" {
+		t.Errorf("serving %q after the files changed, want second", name)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		valid bool
+	}{
+		{name: "plain HTTP", valid: true},
+		{name: "TLS", env: map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem"}, valid: true},
+		{name: "certificate without key", env: map[string]string{"TLS_CERT_FILE": "cert.pem"}},
+		{name: "client CA without TLS", env: map[string]string{"TLS_CLIENT_CA_FILE": "ca.pem"}},
+		{
+			name:  "required client certificates",
+			env:   map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "TLS_CLIENT_CA_FILE": "ca.pem", "TLS_CLIENT_AUTH": "require"},
+			valid: true,
+		},
+		{name: "required client certificates without CA", env: map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "TLS_CLIENT_AUTH": "require"}},
+		{name: "unknown client auth", env: map[string]string{"TLS_CLIENT_AUTH": "always"}},
+		{name: "h2c", env: map[string]string{"H2C": "true"}, valid: true},
+		{name: "h2c with TLS", env: map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "H2C": "true"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"ADDRESS", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE", "TLS_CLIENT_AUTH", "H2C"} {
+				t.Setenv(name, test.env[name])
+			}
+			config, err := ConfigFromEnv()
+			if (err == nil) != test.valid {
+				t.Fatalf("got error %v, want valid %v", err, test.valid)
+			}
+			if err == nil && config.Address != defaultAddress {
+				t.Errorf("Address = %q, want %q", config.Address, defaultAddress)
+			}
+		})
+	}
+}
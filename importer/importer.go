@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ftilie/go-booking-api/calendar"
+	"github.com/ftilie/go-booking-api/models"
+)
+
+// Row is an event read from an import file along with the problems found in it
+type Row struct {
+	Number int // Data row in a CSV file, or VEVENT position in an iCalendar file, starting at 1
+	Event  models.Event
+	Errors []string
+}
+
+// Fields lists the event fields that can be imported, as used in header mappings
+var Fields = []string{"title", "description", "location", "startTime", "endTime", "price"}
+
+func ReadCSV(reader io.Reader, mapping map[string]string) ([]Row, error) {
+	// This function will read one event per CSV row, the mapping gives the header used for each field.
+	// Fields without a mapping are looked up by their own name, ignoring case, dashes and underscores.
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file is empty")
+		}
+		return nil, err
+	}
+
+	columns, err := resolveColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		row := Row{Number: len(rows) + 1}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			row.Errors = append(row.Errors, parseErr.Err.Error())
+			rows = append(rows, row)
+			continue
+		}
+		for field, column := range columns {
+			if column >= len(record) {
+				continue
+			}
+			if err := setField(&row.Event, field, strings.TrimSpace(record[column])); err != nil {
+				row.Errors = append(row.Errors, fmt.Sprintf("%s: %s", field, err.Error()))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func ReadICS(reader io.Reader) ([]Row, error) {
+	// This function will read one event per VEVENT of an iCalendar file
+	document, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := calendar.Decode(string(document))
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]Row, 0, len(decoded))
+	for _, event := range decoded {
+		rows = append(rows, Row{Number: event.Index, Event: event.Event, Errors: event.Errors})
+	}
+	return rows, nil
+}
+
+func resolveColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	for field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+	}
+
+	columns := make(map[string]int)
+	for _, field := range Fields {
+		name, mapped := mapping[field]
+		if !mapped {
+			name = field
+		}
+		found := false
+		for index, column := range header {
+			if normalize(column) == normalize(name) {
+				columns[field] = index
+				found = true
+				break
+			}
+		}
+		if mapped && !found {
+			return nil, fmt.Errorf("column %q mapped to %s is missing from the header", name, field)
+		}
+	}
+	return columns, nil
+}
+
+func isField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(name string) string {
+	name = strings.ReplaceAll(name, "_", "")
+	name = strings.ReplaceAll(name, "-", "")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func setField(event *models.Event, field, value string) error {
+	switch field {
+	case "title":
+		event.Title = value
+	case "description":
+		event.Description = value
+	case "location":
+		event.Location = value
+	case "startTime", "endTime":
+		if value == "" {
+			return nil // Left empty so validation reports the missing field
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return errors.New("must be an RFC 3339 timestamp")
+		}
+		if field == "startTime" {
+			event.StartTime = parsed
+		} else {
+			event.EndTime = parsed
+		}
+	case "price":
+		if value == "" {
+			return nil
+		}
+		price, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		event.Price = price
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	header := "title,description,location,startTime,endTime,price\n"
+	tests := []struct {
+		name    string
+		file    string
+		mapping map[string]string
+		rows    int
+		errors  map[int]string // Row number to the start of its first error
+		err     string
+	}{
+		{name: "valid rows", file: header +
+			"Go meetup,Talks,Cluj,2030-05-01T18:00:00Z,2030-05-01T20:00:00Z,1500\n" +
+			"Rust meetup,,Iasi,2030-05-02T18:00:00+03:00,2030-05-02T20:00:00+03:00,\n", rows: 2},
+		{name: "bad timestamp and price", file: header +
+			"Go meetup,,,tomorrow,2030-05-01T20:00:00Z,10\n" +
+			"Rust meetup,,,2030-05-02T18:00:00Z,2030-05-02T20:00:00Z,12.50\n",
+			rows: 2, errors: map[int]string{1: "startTime: must be an RFC 3339 timestamp", 2: "price: must be a whole number"}},
+		{name: "malformed row", file: header +
+			"Go \"meetup,,,2030-05-01T18:00:00Z,2030-05-01T20:00:00Z,0\n" +
+			"Rust meetup,,,2030-05-02T18:00:00Z,2030-05-02T20:00:00Z,0\n",
+			rows: 2, errors: map[int]string{1: `bare " in non-quoted-field`}},
+		{name: "row with missing columns", file: header +
+			"Go meetup,,Cluj\n" +
+			"Rust meetup,,,2030-05-02T18:00:00Z,2030-05-02T20:00:00Z,0\n",
+			rows: 2, errors: map[int]string{1: "wrong number of fields"}},
+		{name: "optional columns left out", file: "Title,Start_Time,end-time\nGo meetup,2030-05-01T18:00:00Z,2030-05-01T20:00:00Z\n", rows: 1},
+		{name: "mapped headers", file: "Name,From,To\nGo meetup,2030-05-01T18:00:00Z,2030-05-01T20:00:00Z\n",
+			mapping: map[string]string{"title": "Name", "startTime": "From", "endTime": "To"}, rows: 1},
+		{name: "mapped header missing", file: header, mapping: map[string]string{"title": "Name"}, err: `column "Name" mapped to title is missing from the header`},
+		{name: "unknown mapped field", file: header, mapping: map[string]string{"organizer": "Owner"}, err: `unknown field "organizer" in mapping`},
+		{name: "empty file", file: "", err: "file is empty"},
+		{name: "header only", file: header, rows: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := ReadCSV(strings.NewReader(test.file), test.mapping)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("ReadCSV error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != test.rows {
+				t.Fatalf("got %d rows, want %d", len(rows), test.rows)
+			}
+			for i, row := range rows {
+				if row.Number != i+1 {
+					t.Errorf("row %d is numbered %d", i+1, row.Number)
+				}
+				want, failed := test.errors[row.Number]
+				if !failed && len(row.Errors) > 0 {
+					t.Errorf("row %d got errors %q, want none", row.Number, row.Errors)
+				}
+				if failed && (len(row.Errors) == 0 || !strings.HasPrefix(row.Errors[0], want)) {
+					t.Errorf("row %d got errors %q, want %q", row.Number, row.Errors, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCSVFields(t *testing.T) {
+	file := "Title,Start_Time,End-Time,PRICE\nGo meetup,2030-05-01T18:00:00+03:00,2030-05-01T20:00:00+03:00,1500\n"
+	rows, err := ReadCSV(strings.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := rows[0].Event
+	start := time.Date(2030, time.May, 1, 15, 0, 0, 0, time.UTC)
+	if event.Title != "Go meetup" || !event.StartTime.Equal(start) || !event.EndTime.Equal(start.Add(2*time.Hour)) || event.Price != 1500 {
+		t.Errorf("got event %+v", event)
+	}
+}
+
+func TestReadICS(t *testing.T) {
+	document := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"SUMMARY:Go meetup\\, spring edition with a title long enough to be folded ove",
+		" r two lines",
+		"DESCRIPTION:Talks\\nand pizza",
+		"DTSTART;TZID=Europe/Bucharest:20300501T180000",
+		"DTEND:20300501T170000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:Broken",
+		"DTSTART:yesterday",
+		"DTEND;TZID=Mars/Olympus:20300501T170000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	rows, err := ReadICS(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	event := rows[0].Event
+	if event.Title != "Go meetup, spring edition with a title long enough to be folded over two lines" || event.Description != "Talks\nand pizza" {
+		t.Errorf("got title %q and description %q", event.Title, event.Description)
+	}
+	start := time.Date(2030, time.May, 1, 15, 0, 0, 0, time.UTC) // Bucharest is 3 hours ahead in May
+	if !event.StartTime.Equal(start) || !event.EndTime.Equal(start.Add(2*time.Hour)) || len(rows[0].Errors) != 0 {
+		t.Errorf("got times %s to %s with errors %q", event.StartTime, event.EndTime, rows[0].Errors)
+	}
+	if rows[1].Number != 2 || len(rows[1].Errors) != 2 ||
+		!strings.HasPrefix(rows[1].Errors[0], "DTSTART:") || !strings.Contains(rows[1].Errors[1], `unknown time zone "Mars/Olympus"`) {
+		t.Errorf("got row %d with errors %q, want both times reported", rows[1].Number, rows[1].Errors)
+	}
+
+	if _, err := ReadICS(strings.NewReader("title,startTime\n")); err == nil {
+		t.Error("ReadICS accepted a CSV file")
+	}
+}
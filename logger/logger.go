@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log is the application wide JSON logger
+var Log = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+const RequestIdKey = "requestId" // Context key holding the ID of the current request
+
+func Init() {
+	// This function will configure the logger, LOG_LEVEL accepts debug, info, warn or error
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	Log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(Log)
+}
+
+func FromContext(context *gin.Context) *slog.Logger {
+	// Returns a logger that tags every record with the request ID, the trace ID and the authenticated user
+	requestLogger := Log.With("requestId", context.GetString(RequestIdKey))
+	if spanContext := trace.SpanContextFromContext(context.Request.Context()); spanContext.IsValid() {
+		requestLogger = requestLogger.With("traceId", spanContext.TraceID().String())
+	}
+	if userId, ok := context.Get("userId"); ok {
+		requestLogger = requestLogger.With("userId", userId)
+	}
+	return requestLogger
+}
@@ -1,19 +1,155 @@
 package main
 
 import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ftilie/go-booking-api/buildinfo"
 	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/ftilie/go-booking-api/httpserver"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/ftilie/go-booking-api/middlewares"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/payments"
 	"github.com/ftilie/go-booking-api/routes"
+	"github.com/ftilie/go-booking-api/signing"
+	"github.com/ftilie/go-booking-api/tracing"
+	"github.com/ftilie/go-booking-api/utils"
+	"github.com/ftilie/go-booking-api/validation"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
 	// This is the entry point of the application.
-	database.InitDB() // Initialize the database connection
-	server := gin.Default()
+	logger.Init()         // Configure the structured logger
+	validation.Register() // Add the custom request validation rules
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.Log.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	database.InitDB(database.Path()) // Initialize the database connection
+	metrics.RegisterDatabase(database.DB)
+	health.Register("database", database.CheckConnection)
+	health.Register("migrations", database.CheckMigrations)
+
+	tokenOptions, err := utils.TokenOptionsFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid token configuration", "error", err)
+		os.Exit(1)
+	}
+	utils.Tokens = tokenOptions
+	signingOptions, err := signing.OptionsFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid signing key configuration", "error", err)
+		os.Exit(1)
+	}
+	if signingOptions.EncryptionKey == nil {
+		logger.Log.Warn("no signing key encryption key configured, private signing keys are stored unencrypted")
+	}
+	signingKeys, err := signing.NewRing(context.Background(), signingOptions)
+	if err != nil {
+		logger.Log.Error("failed to load the signing keys", "error", err)
+		os.Exit(1)
+	}
+	utils.Keys = signingKeys
+	keyRotation := &health.Worker{}
+	health.Register("key-rotation", keyRotation.Check)
+	go signingKeys.Run(context.Background(), keyRotation, time.Minute)
+
+	ticketSecret, err := utils.TicketSecretFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid ticket secret", "error", err)
+		os.Exit(1)
+	}
+	if ticketSecret == nil {
+		ticketSecret, err = models.TicketSecret(context.Background()) // Generated once and shared through the database
+		if err != nil {
+			logger.Log.Error("failed to load the ticket secret", "error", err)
+			os.Exit(1)
+		}
+	}
+	utils.TicketSecret = ticketSecret
+
+	idempotencyCleanup := &health.Worker{}
+	health.Register("idempotency-cleanup", idempotencyCleanup.Check)
+	go middlewares.CleanIdempotencyKeys(context.Background(), idempotencyCleanup, time.Hour)
+
+	revokedTokenCleanup := &health.Worker{}
+	health.Register("revoked-token-cleanup", revokedTokenCleanup.Check)
+	go models.CleanRevokedTokens(context.Background(), revokedTokenCleanup, time.Hour)
+
+	refundProvider, err := payments.ProviderFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid refund provider configuration", "error", err)
+		os.Exit(1)
+	}
+	if refundProvider != nil {
+		payments.Provider = refundProvider
+	} else {
+		logger.Log.Warn("no refund provider configured, refunds are recorded as failed until one is")
+	}
+	refundRetries := &health.Worker{}
+	health.Register("refund-retries", refundRetries.Check)
+	go models.RetryRefunds(context.Background(), refundRetries, 5*time.Minute)
+
+	corsOptions, err := middlewares.CORSOptionsFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid CORS configuration", "error", err)
+		os.Exit(1)
+	}
+	securityOptions, err := middlewares.SecurityOptionsFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid security headers configuration", "error", err)
+		os.Exit(1)
+	}
+
+	server := gin.New()
+	// Only the listed proxies are trusted with X-Forwarded-For, otherwise ClientIP is the address of the connection
+	proxies := trustedProxies()
+	if err := server.SetTrustedProxies(proxies); err != nil {
+		logger.Log.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	forwardedScheme, err := middlewares.ForwardedScheme(proxies)
+	if err != nil {
+		logger.Log.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	server.Use(otelgin.Middleware(tracing.ServiceName), middlewares.RequestId, middlewares.Logger, middlewares.Metrics, middlewares.Recovery,
+		forwardedScheme, middlewares.SecurityHeaders(securityOptions), middlewares.CORS(corsOptions), middlewares.Errors)
 
 	// Register the routes
-	routes.RegisterRoutes(server)
+	routes.RegisterRoutes(server, routes.DefaultRateLimits())
+
+	serverConfig, err := httpserver.ConfigFromEnv()
+	if err != nil {
+		logger.Log.Error("invalid server configuration", "error", err)
+		os.Exit(1)
+	}
 
 	// Start application server
-	server.Run(":8080") // Start the server on port 8080
+	logger.Log.Info("starting server", "address", serverConfig.Address, "tls", serverConfig.TLS(), "h2c", serverConfig.H2C,
+		"version", buildinfo.Version, "commit", buildinfo.Commit)
+	if err := httpserver.ListenAndServe(serverConfig, server); err != nil {
+		logger.Log.Error("server stopped", "error", err)
+	}
+}
+
+func trustedProxies() []string {
+	// Returns the IP addresses and CIDR ranges listed in TRUSTED_PROXIES, e.g. "10.0.0.0/8, 192.168.1.2"
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
@@ -1,26 +1,82 @@
 package middlewares
 
 import (
-	"net/http"
+	"strings"
 
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/models"
 	"github.com/ftilie/go-booking-api/utils"
 	"github.com/gin-gonic/gin"
 )
 
+const TokenClaimsKey = "tokenClaims" // Context key holding the *utils.Claims of the authenticated request
+
+// Challenges sent in WWW-Authenticate (RFC 6750) so clients know to send a Bearer token
+const (
+	bearerChallenge         = `Bearer realm="go-booking-api"`
+	invalidRequestChallenge = bearerChallenge + `, error="invalid_request"`
+	invalidTokenChallenge   = bearerChallenge + `, error="invalid_token"`
+)
+
 func Authenticate(context *gin.Context) {
-	// This middleware function will check if the user is authenticated
-	token := context.Request.Header.Get("Authorization")
+	// This middleware function will check if the user is authenticated.
+	// Tokens are sent as "Authorization: Bearer <token>", the bare token older clients send is still accepted.
+	token, ok := bearerToken(context.Request.Header.Get("Authorization"))
+	if !ok {
+		context.Header("WWW-Authenticate", invalidRequestChallenge)
+		context.Error(apperrors.Unauthorized("invalid_authorization", "The Authorization header must be Bearer followed by the token"))
+		context.Abort()
+		return
+	}
 	if token == "" {
-		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized!"})
+		context.Header("WWW-Authenticate", bearerChallenge)
+		context.Error(apperrors.Unauthorized("missing_token", "Authentication is required"))
+		context.Abort()
+		return
+	}
+
+	claims, err := utils.VerifyToken(token) // Verify the token to ensure the user is authenticated
+	if err != nil {
+		context.Header("WWW-Authenticate", invalidTokenChallenge)
+		context.Error(apperrors.Unauthorized("invalid_token", "Invalid or expired token"))
+		context.Abort()
 		return
 	}
 
-	userId, err := utils.VerifyToken(token) // Verify the token to ensure the user is authenticated
+	revoked, err := models.IsTokenRevoked(context.Request.Context(), claims.ID)
 	if err != nil {
-		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token!"})
+		context.Error(apperrors.Internal("Failed to check whether the token was revoked", err))
+		context.Abort()
 		return
 	}
+	if revoked {
+		context.Header("WWW-Authenticate", invalidTokenChallenge)
+		context.Error(apperrors.Unauthorized("revoked_token", "This token was revoked, log in again"))
+		context.Abort()
+		return
+	}
+
+	context.Set("userId", claims.UserId()) // Store the user ID in the context for later use
+	context.Set(TokenClaimsKey, claims)
+	context.Next() // If the token is valid, proceed to the next handler
+}
+
+func bearerToken(header string) (string, bool) {
+	// Returns the token of the Authorization header, false when it uses another scheme than Bearer
+	header = strings.TrimSpace(header)
+	scheme, token, found := strings.Cut(header, " ")
+	if !found {
+		return header, true // A bare token, or nothing at all
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
 
-	context.Set("userId", userId) // Store the user ID in the context for later use
-	context.Next()                // If the token is valid, proceed to the next handler
+func TokenClaims(context *gin.Context) *utils.Claims {
+	// Returns the claims of the token the request was authenticated with, nil before Authenticate ran
+	claims, _ := context.Get(TokenClaimsKey)
+	tokenClaims, _ := claims.(*utils.Claims)
+	return tokenClaims
 }
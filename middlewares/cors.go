@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSOptions lists who may call the API from a browser, the zero value allows no other origin
+type CORSOptions struct {
+	AllowedOrigins   []string // Origins such as https://app.example.com, "*" allows any origin
+	AllowedMethods   []string
+	AllowedHeaders   []string // Request headers scripts may send
+	ExposedHeaders   []string // Response headers scripts may read besides the CORS-safelisted ones
+	AllowCredentials bool     // Whether browsers may send cookies and HTTP authentication along
+	MaxAge           time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", IdempotencyKeyHeader, RequestIdHeader}
+	corsExposedHeaders = []string{
+		"ETag", "Link", "Deprecation", "Sunset", "Retry-After",
+		"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+		IdempotentReplayedHeader, RequestIdHeader,
+	}
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+func CORSOptionsFromEnv() (CORSOptions, error) {
+	// Returns the options set by CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS and CORS_ALLOW_CREDENTIALS.
+	// Without allowed origins cross-origin requests keep being refused by browsers.
+	options := CORSOptions{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS"),
+		AllowedMethods: envList("CORS_ALLOWED_METHODS"),
+		AllowedHeaders: defaultCORSHeaders,
+		ExposedHeaders: corsExposedHeaders,
+		MaxAge:         defaultCORSMaxAge,
+	}
+	if len(options.AllowedMethods) == 0 {
+		options.AllowedMethods = defaultCORSMethods
+	}
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return CORSOptions{}, errors.New("CORS_ALLOW_CREDENTIALS must be true or false")
+		}
+		options.AllowCredentials = allow
+	}
+	if options.AllowCredentials && slices.Contains(options.AllowedOrigins, "*") {
+		return CORSOptions{}, errors.New("CORS_ALLOW_CREDENTIALS cannot be used when CORS_ALLOWED_ORIGINS is *, list the origins instead")
+	}
+	return options, nil
+}
+
+func CORS(options CORSOptions) gin.HandlerFunc {
+	// This middleware function will let browsers call the API from the allowed origins.
+	// Preflight requests are answered here, before routing, and requests from other origins get no CORS headers.
+	anyOrigin := slices.Contains(options.AllowedOrigins, "*")
+	allowedMethods := strings.Join(options.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(options.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(options.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(options.MaxAge.Seconds()))
+
+	return func(context *gin.Context) {
+		origin := context.GetHeader("Origin")
+		if origin == "" {
+			context.Next()
+			return
+		}
+		context.Writer.Header().Add("Vary", "Origin") // Caches must not serve the headers of one origin to another
+		preflight := context.Request.Method == http.MethodOptions && context.GetHeader("Access-Control-Request-Method") != ""
+
+		if !anyOrigin && !slices.ContainsFunc(options.AllowedOrigins, func(allowed string) bool { return strings.EqualFold(allowed, origin) }) {
+			if preflight {
+				context.AbortWithStatus(http.StatusNoContent) // Without the headers the browser refuses the actual request
+				return
+			}
+			context.Next()
+			return
+		}
+
+		if anyOrigin && !options.AllowCredentials {
+			context.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			context.Header("Access-Control-Allow-Origin", origin)
+		}
+		if options.AllowCredentials {
+			context.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			context.Header("Access-Control-Allow-Methods", allowedMethods)
+			context.Header("Access-Control-Allow-Headers", allowedHeaders)
+			context.Header("Access-Control-Max-Age", maxAge)
+			context.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if exposedHeaders != "" {
+			context.Header("Access-Control-Expose-Headers", exposedHeaders)
+		}
+		context.Next()
+	}
+}
+
+func envList(name string) []string {
+	// Returns the comma separated values of the environment variable, without blanks
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
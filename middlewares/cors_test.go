@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSEngine(options CORSOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CORS(options))
+	engine.GET("/events", func(context *gin.Context) { context.Status(http.StatusOK) })
+	return engine
+}
+
+func serveCORS(engine *gin.Engine, method, origin string, headers ...string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/events", nil)
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORS(t *testing.T) {
+	options := CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   defaultCORSMethods,
+		AllowedHeaders:   defaultCORSHeaders,
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           defaultCORSMaxAge,
+	}
+	engine := newCORSEngine(options)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		headers     []string
+		status      int
+		allowOrigin string
+		allowMethod bool
+	}{
+		{name: "same origin", method: http.MethodGet, status: http.StatusOK},
+		{name: "allowed origin", method: http.MethodGet, origin: "https://app.example.com", status: http.StatusOK, allowOrigin: "https://app.example.com"},
+		{name: "origins are case insensitive", method: http.MethodGet, origin: "https://APP.example.com", status: http.StatusOK, allowOrigin: "https://APP.example.com"},
+		{name: "other origin", method: http.MethodGet, origin: "https://evil.example.com", status: http.StatusOK},
+		{
+			name: "preflight", method: http.MethodOptions, origin: "https://app.example.com",
+			headers: []string{"Access-Control-Request-Method", "PATCH"}, status: http.StatusNoContent,
+			allowOrigin: "https://app.example.com", allowMethod: true,
+		},
+		{
+			name: "preflight from other origin", method: http.MethodOptions, origin: "https://evil.example.com",
+			headers: []string{"Access-Control-Request-Method", "PATCH"}, status: http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serveCORS(engine, test.method, test.origin, test.headers...)
+			if response.Code != test.status {
+				t.Fatalf("got status %d, want %d", response.Code, test.status)
+			}
+			if got := response.Header().Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, test.allowOrigin)
+			}
+			if got := response.Header().Get("Access-Control-Allow-Methods") != ""; got != test.allowMethod {
+				t.Errorf("Access-Control-Allow-Methods set = %v, want %v", got, test.allowMethod)
+			}
+			if test.origin != "" && response.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", response.Header().Get("Vary"))
+			}
+			if test.allowOrigin != "" && test.method == http.MethodGet {
+				if response.Header().Get("Access-Control-Allow-Credentials") != "true" {
+					t.Error("credentials are not allowed")
+				}
+				if response.Header().Get("Access-Control-Expose-Headers") == "" {
+					t.Error("no headers are exposed")
+				}
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	engine := newCORSEngine(CORSOptions{AllowedOrigins: []string{"*"}})
+	response := serveCORS(engine, http.MethodGet, "https://any.example.com")
+	if got := response.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestCORSOptionsFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://app.example.com, ,https://admin.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	options, err := CORSOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.AllowedOrigins) != 2 || options.AllowedOrigins[1] != "https://admin.example.com" || !options.AllowCredentials {
+		t.Errorf("got %+v", options)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	if _, err := CORSOptionsFromEnv(); err == nil {
+		t.Error("credentials were allowed for any origin")
+	}
+}
@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const ProblemContentType = "application/problem+json"
+
+var statuses = map[error]int{
+	apperrors.ErrBadRequest:           http.StatusBadRequest,
+	apperrors.ErrValidation:           http.StatusUnprocessableEntity,
+	apperrors.ErrUnauthorized:         http.StatusUnauthorized,
+	apperrors.ErrForbidden:            http.StatusForbidden,
+	apperrors.ErrNotFound:             http.StatusNotFound,
+	apperrors.ErrConflict:             http.StatusConflict,
+	apperrors.ErrPreconditionFailed:   http.StatusPreconditionFailed,
+	apperrors.ErrPreconditionRequired: http.StatusPreconditionRequired,
+	apperrors.ErrPayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	apperrors.ErrUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperrors.ErrTooManyRequests:      http.StatusTooManyRequests,
+	apperrors.ErrInternal:             http.StatusInternalServerError,
+}
+
+func Errors(context *gin.Context) {
+	// This middleware function will render the last error attached by a handler as RFC 7807 problem details
+	context.Next()
+
+	if len(context.Errors) == 0 || context.Writer.Written() {
+		return
+	}
+	WriteProblem(context, context.Errors.Last().Err)
+}
+
+func WriteProblem(context *gin.Context, err error) {
+	// Errors that are not domain errors are hidden behind a generic message, their details only go to the log
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) {
+		appErr = apperrors.Internal("An unexpected error occurred", err)
+	}
+
+	status, ok := statuses[appErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if status >= http.StatusInternalServerError {
+		logger.FromContext(context).Error(appErr.Message, "code", appErr.Code, "error", appErr.Cause)
+	}
+
+	problem := gin.H{}
+	for key, value := range appErr.Extensions {
+		problem[key] = value
+	}
+	problem["type"] = "urn:go-booking-api:problem:" + appErr.Code
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	problem["detail"] = appErr.Message
+	problem["instance"] = context.Request.URL.Path
+	problem["code"] = appErr.Code
+	if requestId := context.GetString(logger.RequestIdKey); requestId != "" {
+		problem["requestId"] = requestId
+	}
+	if len(appErr.Fields) > 0 {
+		problem["errors"] = appErr.Fields
+	}
+
+	context.Header("Content-Type", ProblemContentType)
+	context.AbortWithStatusJSON(status, problem)
+}
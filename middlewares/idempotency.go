@@ -0,0 +1,161 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestSize  = 10 << 20 // 10 MiB, the largest body accepted by the API
+	idempotencyCleanupTimeout = time.Minute
+)
+
+var (
+	errIdempotencyKeyInvalid    = apperrors.BadRequest("invalid_idempotency_key", "Idempotency keys must be between 1 and 255 characters long")
+	errIdempotencyKeyReused     = apperrors.New(apperrors.ErrValidation, "idempotency_key_reused", "This idempotency key was already used for a different request")
+	errIdempotencyKeyInProgress = apperrors.Conflict("idempotency_key_in_progress", "A request with this idempotency key is still being processed")
+)
+
+// recordingWriter keeps a copy of the response body so it can be replayed later
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+func Idempotency(context *gin.Context) {
+	// This middleware function will make POST requests safe to retry when they carry an Idempotency-Key header.
+	// The first request runs normally and its response is stored, retries with the same key and body get the
+	// stored response back, and reusing the key for a different request is rejected. It must run after Authenticate.
+	key := context.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		context.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		context.Error(errIdempotencyKeyInvalid)
+		context.Abort()
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(context.Writer, context.Request.Body, maxIdempotentRequestSize))
+	if err != nil {
+		context.Error(apperrors.BadRequest("unreadable_body", "Failed to read the request body"))
+		context.Abort()
+		return
+	}
+	context.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	requestFingerprint := fingerprint(context.Request, body)
+	record, reserved, err := models.ReserveIdempotencyKey(context.Request.Context(), context.GetInt64("userId"), key, requestFingerprint)
+	if err != nil {
+		context.Error(apperrors.Internal("Failed to look up the idempotency key", err))
+		context.Abort()
+		return
+	}
+	if !reserved {
+		replay(context, record, requestFingerprint)
+		return
+	}
+
+	// The key is released when the request fails on our side or panics, so the client can retry it
+	completed := false
+	defer func() {
+		if !completed {
+			if err := record.Release(context.Request.Context()); err != nil {
+				logger.FromContext(context).Error("failed to release idempotency key", "error", err)
+			}
+		}
+	}()
+
+	writer := &recordingWriter{ResponseWriter: context.Writer}
+	context.Writer = writer
+	context.Next()
+	context.Writer = writer.ResponseWriter
+
+	// Errors are rendered here rather than by the Errors middleware so the stored response includes them
+	if len(context.Errors) > 0 && !writer.Written() {
+		context.Writer = writer
+		WriteProblem(context, context.Errors.Last().Err)
+		context.Writer = writer.ResponseWriter
+	}
+
+	status := writer.Status()
+	if status >= http.StatusInternalServerError {
+		return
+	}
+	err = record.Complete(context.Request.Context(), status, writer.Header().Get("Content-Type"), writer.body.Bytes())
+	if err != nil {
+		logger.FromContext(context).Error("failed to store idempotent response", "error", err)
+		return
+	}
+	completed = true
+}
+
+func fingerprint(request *http.Request, body []byte) string {
+	// Requests are the same when they target the same URL with the same body
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(context *gin.Context, record *models.IdempotencyKey, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		context.Error(errIdempotencyKeyReused)
+	case !record.Completed():
+		context.Error(errIdempotencyKeyInProgress)
+	default:
+		context.Header(IdempotentReplayedHeader, "true")
+		context.Data(record.Status, record.ContentType, record.Body)
+	}
+	context.Abort()
+}
+
+func CleanIdempotencyKeys(ctx context.Context, worker *health.Worker, interval time.Duration) {
+	// This function will delete expired idempotency keys every interval until the context is cancelled
+	worker.SetRunning(true)
+	defer worker.SetRunning(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanupCtx, cancel := context.WithTimeout(ctx, idempotencyCleanupTimeout)
+			deleted, err := models.DeleteExpiredIdempotencyKeys(cleanupCtx)
+			cancel()
+			if err != nil {
+				logger.Log.Error("failed to delete expired idempotency keys", "error", err)
+				continue
+			}
+			logger.Log.Debug("deleted expired idempotency keys", "count", deleted)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func RequestId(context *gin.Context) {
+	// This middleware function will reuse the caller's request ID or assign a new one
+	requestId := context.GetHeader(RequestIdHeader)
+	if !validRequestId.MatchString(requestId) {
+		requestId = newRequestId()
+	}
+
+	context.Set(logger.RequestIdKey, requestId)
+	context.Header(RequestIdHeader, requestId) // Echo the ID so clients can quote it when reporting problems
+	context.Next()
+}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func Logger(context *gin.Context) {
+	// This middleware function will write one structured log record per request
+	start := time.Now()
+	context.Next()
+
+	route := context.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := context.Writer.Status()
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	} else if status >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+
+	logger.FromContext(context).Log(context.Request.Context(), level, "request completed",
+		"method", context.Request.Method,
+		"route", route,
+		"path", context.Request.URL.Path,
+		"status", status,
+		"latencyMs", float64(time.Since(start).Microseconds())/1000,
+		"clientIp", context.ClientIP(),
+		"bytes", context.Writer.Size(),
+	)
+}
+
+// Recovery turns handler panics into 500 responses and logs them with their stack trace
+var Recovery = gin.CustomRecoveryWithWriter(io.Discard, logPanic)
+
+func logPanic(context *gin.Context, recovered any) {
+	logger.FromContext(context).Error("panic recovered", "panic", recovered, "stack", string(debug.Stack()))
+	WriteProblem(context, apperrors.Internal("An unexpected error occurred", fmt.Errorf("panic: %v", recovered)))
+}
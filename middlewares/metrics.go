@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func Metrics(context *gin.Context) {
+	// This middleware function will count requests and record their latency per route template
+	start := time.Now()
+	context.Next()
+
+	route := context.FullPath()
+	if route == "" {
+		route = "unmatched" // Keeps label cardinality bounded when clients probe random paths
+	}
+	method := context.Request.Method
+	status := strconv.Itoa(context.Writer.Status())
+
+	metrics.HTTPRequests.WithLabelValues(method, route, status).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const SchemeKey = "scheme" // Context key holding the scheme the client connected with, "http" or "https"
+
+func ForwardedScheme(trustedProxies []string) (gin.HandlerFunc, error) {
+	// This middleware function will record the scheme the client used. TLS usually ends at the proxy,
+	// so X-Forwarded-Proto is believed when the connection comes from one of the trusted proxies.
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(context *gin.Context) {
+		scheme := "http"
+		if context.Request.TLS != nil {
+			scheme = "https"
+		}
+		if trusted(prefixes, context.RemoteIP()) {
+			if forwarded := lastForwardedProto(context.Request.Header.Values("X-Forwarded-Proto")); forwarded == "http" || forwarded == "https" {
+				scheme = forwarded
+			}
+		}
+		context.Set(SchemeKey, scheme)
+		context.Next()
+	}, nil
+}
+
+func lastForwardedProto(values []string) string {
+	// Proxies append to the header and clients can send their own value first,
+	// so only the right-most value, added by the proxy the request came through, is believed
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if comma := strings.LastIndex(last, ","); comma >= 0 {
+		last = last[comma+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(last))
+}
+
+func RequestScheme(context *gin.Context) string {
+	// Returns the scheme the client used, falling back to the connection when ForwardedScheme did not run
+	if scheme := context.GetString(SchemeKey); scheme != "" {
+		return scheme
+	}
+	if context.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func parseProxy(proxy string) (netip.Prefix, error) {
+	// Accepts the same entries as TRUSTED_PROXIES, a CIDR range or a single IP address
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func trusted(prefixes []netip.Prefix, remoteIP string) bool {
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
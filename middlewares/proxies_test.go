@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForwardedScheme(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	forwardedScheme, err := ForwardedScheme([]string{"10.0.0.0/8", "192.168.1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.Use(forwardedScheme)
+	engine.GET("/scheme", func(context *gin.Context) { context.String(http.StatusOK, RequestScheme(context)) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		forwarded  string
+		want       string
+	}{
+		{name: "plain connection", remoteAddr: "203.0.113.7:1234", want: "http"},
+		{name: "TLS connection", remoteAddr: "203.0.113.7:1234", tls: true, want: "https"},
+		{name: "trusted range", remoteAddr: "10.1.2.3:1234", forwarded: "https", want: "https"},
+		{name: "trusted address", remoteAddr: "192.168.1.2:1234", forwarded: "HTTPS", want: "https"},
+		{name: "nearest proxy of a chain", remoteAddr: "10.1.2.3:1234", forwarded: "http, https", want: "https"},
+		{name: "value sent by the client", remoteAddr: "10.1.2.3:1234", forwarded: "https, http", want: "http"},
+		{name: "untrusted client", remoteAddr: "203.0.113.7:1234", forwarded: "https", want: "http"},
+		{name: "proxy downgrading TLS", remoteAddr: "10.1.2.3:1234", tls: true, forwarded: "http", want: "http"},
+		{name: "unknown scheme", remoteAddr: "10.1.2.3:1234", forwarded: "gopher", want: "http"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/scheme", nil)
+			request.RemoteAddr = test.remoteAddr
+			if test.tls {
+				request.TLS = &tls.ConnectionState{}
+			}
+			if test.forwarded != "" {
+				request.Header.Set("X-Forwarded-Proto", test.forwarded)
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+			if got := recorder.Body.String(); got != test.want {
+				t.Errorf("scheme = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// Proxies may add a header line of their own instead of appending to the existing one
+	request := httptest.NewRequest(http.MethodGet, "/scheme", nil)
+	request.RemoteAddr = "10.1.2.3:1234"
+	request.Header.Add("X-Forwarded-Proto", "http")
+	request.Header.Add("X-Forwarded-Proto", "https")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if got := recorder.Body.String(); got != "https" {
+		t.Errorf("scheme with two header lines = %q, want the last one", got)
+	}
+
+	if _, err := ForwardedScheme([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ForwardedScheme accepted an invalid range")
+	}
+}
@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/ftilie/go-booking-api/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+var errRateLimited = apperrors.New(apperrors.ErrTooManyRequests, "rate_limited", "Too many requests, retry after the delay given in the Retry-After header")
+
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit) gin.HandlerFunc {
+	// This middleware function will limit the requests of each user, or of each client IP address before
+	// authentication, to the given limit. Routes limited under the same name share their buckets.
+	// It must run after Authenticate for authenticated requests to be counted per user.
+	// The limit is announced in the RateLimit-* headers and requests over it fail with 429.
+	if limit.Unlimited() {
+		return func(context *gin.Context) { context.Next() }
+	}
+	policy := strconv.Itoa(limit.Burst) + ";w=" + strconv.Itoa(ceilSeconds(limit.Window()))
+
+	return func(context *gin.Context) {
+		key := name + ":ip:" + context.ClientIP()
+		if userId, ok := context.Get("userId"); ok {
+			key = name + ":user:" + strconv.FormatInt(userId.(int64), 10)
+		}
+
+		result, err := store.Take(context.Request.Context(), key, limit)
+		if err != nil {
+			// A broken store must not take the API down with it, requests go through unlimited meanwhile
+			logger.FromContext(context).Warn("rate limit store failed, request not limited", "limit", name, "error", err)
+			context.Next()
+			return
+		}
+
+		context.Header("RateLimit-Policy", policy)
+		context.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		context.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		context.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(name).Inc()
+			context.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			context.Error(errRateLimited)
+			context.Abort()
+			return
+		}
+		context.Next()
+	}
+}
+
+func ceilSeconds(duration time.Duration) int {
+	// Headers carry whole seconds, rounded up so clients never retry too early
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// APIContentSecurityPolicy forbids browsers from running or loading anything from the JSON and iCalendar responses
+	APIContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	// DocsContentSecurityPolicy lets the bundled Swagger UI load its own scripts, styles and inline images
+	DocsContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; frame-ancestors 'none'"
+)
+
+// SecurityOptions configures the security headers sent with every response
+type SecurityOptions struct {
+	HSTSMaxAge time.Duration // How long browsers must only use HTTPS, zero sends no Strict-Transport-Security header
+}
+
+const defaultHSTSMaxAge = 365 * 24 * time.Hour
+
+func SecurityOptionsFromEnv() (SecurityOptions, error) {
+	// Returns the options set by HSTS_MAX_AGE, in seconds, 0 turns HSTS off
+	options := SecurityOptions{HSTSMaxAge: defaultHSTSMaxAge}
+	if value := os.Getenv("HSTS_MAX_AGE"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return SecurityOptions{}, errors.New("HSTS_MAX_AGE must be a number of seconds")
+		}
+		options.HSTSMaxAge = time.Duration(seconds) * time.Second
+	}
+	return options, nil
+}
+
+func SecurityHeaders(options SecurityOptions) gin.HandlerFunc {
+	// This middleware function will send the headers that keep browsers from sniffing, framing or running
+	// the responses, and from reaching the API over plain HTTP once they saw it over HTTPS.
+	// Browsers ignore Strict-Transport-Security on plain HTTP responses, so it is safe to always send.
+	hsts := ""
+	if options.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(options.HSTSMaxAge.Seconds()))
+	}
+
+	return func(context *gin.Context) {
+		header := context.Writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Content-Security-Policy", APIContentSecurityPolicy)
+		if hsts != "" {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		context.Next()
+	}
+}
+
+func ContentSecurityPolicy(policy string) gin.HandlerFunc {
+	// This middleware function will replace the policy set by SecurityHeaders for the routes it is used on
+	return func(context *gin.Context) {
+		context.Header("Content-Security-Policy", policy)
+		context.Next()
+	}
+}
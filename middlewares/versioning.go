@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const APIVersionKey = "apiVersion" // Context key holding the *APIVersion the request was made against
+
+// APIVersion describes one version of the API, mounted under its own path prefix
+type APIVersion struct {
+	Name         string      // Label used in metrics, e.g. "v1"
+	Prefix       string      // Path the version is mounted at, empty for the original unversioned routes
+	DeprecatedAt time.Time   // Zero while the version is supported
+	Sunset       time.Time   // When the version stops being served, zero when no date is set
+	Successor    *APIVersion // Version clients should move to once this one is deprecated
+}
+
+func (v *APIVersion) Deprecated() bool {
+	return !v.DeprecatedAt.IsZero()
+}
+
+// Current returns the version new links should point to, following the successors of deprecated versions
+func (v *APIVersion) Current() *APIVersion {
+	version := v
+	for version.Deprecated() && version.Successor != nil {
+		version = version.Successor
+	}
+	return version
+}
+
+func Versioned(version *APIVersion) gin.HandlerFunc {
+	// This middleware function will tag the request with the API version it was made against and count it.
+	// Deprecated versions announce it with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+	// and link the same resource in the successor version.
+	return func(context *gin.Context) {
+		context.Set(APIVersionKey, version)
+		if version.Deprecated() {
+			context.Header("Deprecation", "@"+strconv.FormatInt(version.DeprecatedAt.Unix(), 10))
+			if !version.Sunset.IsZero() {
+				context.Header("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if version.Successor != nil {
+				path := version.Successor.Prefix + strings.TrimPrefix(context.Request.URL.Path, version.Prefix)
+				context.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+			}
+		}
+
+		context.Next()
+
+		metrics.APIRequests.WithLabelValues(version.Name, strconv.FormatBool(version.Deprecated())).Inc()
+	}
+}
+
+func RequestAPIVersion(context *gin.Context) *APIVersion {
+	// Returns the version the request was routed to, nil for routes outside any version such as /healthz
+	version, _ := context.Get(APIVersionKey)
+	apiVersion, _ := version.(*APIVersion)
+	return apiVersion
+}
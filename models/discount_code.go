@@ -0,0 +1,232 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/database"
+)
+
+const (
+	DiscountKindPercentage = "percentage"
+	DiscountKindFixed      = "fixed"
+)
+
+var (
+	ErrDiscountCodeExists        = apperrors.Conflict("discount_code_exists", "Discount code already exists for this event")
+	ErrDiscountCodeNotFound      = apperrors.NotFound("discount_code_not_found", "Discount code not found")
+	ErrDiscountCodeNotValid      = apperrors.BadRequest("discount_code_not_valid", "Discount code is not valid at this time")
+	ErrDiscountCodeExhausted     = apperrors.Conflict("discount_code_exhausted", "Discount code has reached its usage limit")
+	ErrDiscountCodeNotApplicable = apperrors.BadRequest("discount_code_not_applicable", "Discount code does not apply to this ticket type")
+)
+
+type DiscountCode struct {
+	Id            int64
+	EventId       int64
+	Code          string `binding:"required,max=64"`
+	Kind          string `binding:"required,oneof=percentage fixed"`
+	Value         int64  `binding:"required,min=1,percentage=Kind"` // Percentage off, or amount off in the smallest currency unit
+	MaxUses       int64  `binding:"min=0"`                          // Zero means the code can be used without limit
+	UsedCount     int64
+	ValidFrom     *time.Time
+	ValidUntil    *time.Time `binding:"omitempty,afterfield=ValidFrom"`
+	TicketTypeIds []int64    // Empty means the code applies to every ticket type
+	CreatedAt     time.Time
+}
+
+func (d *DiscountCode) CreateDiscountCode(ctx context.Context) error {
+	// Save the discount code and its ticket type restrictions to the database
+	ctx, span := tracer.Start(ctx, "models.CreateDiscountCode")
+	defer span.End()
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	codeQuery := `
+	INSERT INTO discount_codes (event_id, code, kind, value, max_uses, valid_from, valid_until, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, codeQuery, d.EventId, d.Code, d.Kind, d.Value, d.MaxUses, d.ValidFrom, d.ValidUntil, d.CreatedAt)
+	if database.IsUniqueViolation(err) {
+		return ErrDiscountCodeExists
+	}
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, ticketTypeId := range d.TicketTypeIds {
+		if _, err := getTicketType(ctx, tx, d.EventId, ticketTypeId); err != nil {
+			return err
+		}
+		restrictionQuery := `
+		INSERT INTO discount_code_ticket_types (discount_code_id, ticket_type_id)
+		VALUES (?, ?)`
+		_, err = tx.ExecContext(ctx, restrictionQuery, id, ticketTypeId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	d.Id = id
+	return nil
+}
+
+func GetDiscountCodes(ctx context.Context, eventId int64) ([]DiscountCode, error) {
+	ctx, span := tracer.Start(ctx, "models.GetDiscountCodes")
+	defer span.End()
+
+	codesQuery := `
+	SELECT id, event_id, code, kind, value, max_uses, used_count, valid_from, valid_until, created_at
+	FROM discount_codes WHERE event_id = ?`
+	codesStmt, err := database.DB.PrepareContext(ctx, codesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer codesStmt.Close()
+	codesRows, err := codesStmt.QueryContext(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer codesRows.Close()
+
+	var codes []DiscountCode
+	for codesRows.Next() {
+		var code DiscountCode
+		err := codesRows.Scan(&code.Id, &code.EventId, &code.Code, &code.Kind, &code.Value, &code.MaxUses, &code.UsedCount, &code.ValidFrom, &code.ValidUntil, &code.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	codesRows.Close()
+
+	for i := range codes {
+		ticketTypeIds, err := getDiscountCodeTicketTypes(ctx, database.DB, codes[i].Id)
+		if err != nil {
+			return nil, err
+		}
+		codes[i].TicketTypeIds = ticketTypeIds
+	}
+	return codes, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getDiscountCodeTicketTypes(ctx context.Context, db queryer, discountCodeId int64) ([]int64, error) {
+	ctx, span := tracer.Start(ctx, "models.getDiscountCodeTicketTypes")
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, `SELECT ticket_type_id FROM discount_code_ticket_types WHERE discount_code_id = ?`, discountCodeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ticketTypeIds []int64
+	for rows.Next() {
+		var ticketTypeId int64
+		if err := rows.Scan(&ticketTypeId); err != nil {
+			return nil, err
+		}
+		ticketTypeIds = append(ticketTypeIds, ticketTypeId)
+	}
+	return ticketTypeIds, nil
+}
+
+func getDiscountCodeByCode(ctx context.Context, tx *sql.Tx, eventId int64, code string) (*DiscountCode, error) {
+	ctx, span := tracer.Start(ctx, "models.getDiscountCodeByCode")
+	defer span.End()
+
+	query := `
+	SELECT id, event_id, code, kind, value, max_uses, used_count, valid_from, valid_until, created_at
+	FROM discount_codes WHERE event_id = ? AND code = ?`
+	var discountCode DiscountCode
+	err := tx.QueryRowContext(ctx, query, eventId, code).Scan(&discountCode.Id, &discountCode.EventId, &discountCode.Code, &discountCode.Kind, &discountCode.Value, &discountCode.MaxUses, &discountCode.UsedCount, &discountCode.ValidFrom, &discountCode.ValidUntil, &discountCode.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDiscountCodeNotFound
+		}
+		return nil, err
+	}
+
+	ticketTypeIds, err := getDiscountCodeTicketTypes(ctx, tx, discountCode.Id)
+	if err != nil {
+		return nil, err
+	}
+	discountCode.TicketTypeIds = ticketTypeIds
+	return &discountCode, nil
+}
+
+func (d DiscountCode) checkApplicable(ticketTypeId *int64, now time.Time) error {
+	// Check the validity period and the ticket type restrictions of the code
+	if d.ValidFrom != nil && now.Before(*d.ValidFrom) {
+		return ErrDiscountCodeNotValid
+	}
+	if d.ValidUntil != nil && now.After(*d.ValidUntil) {
+		return ErrDiscountCodeNotValid
+	}
+	if len(d.TicketTypeIds) == 0 {
+		return nil
+	}
+	if ticketTypeId == nil {
+		return ErrDiscountCodeNotApplicable
+	}
+	for _, id := range d.TicketTypeIds {
+		if id == *ticketTypeId {
+			return nil
+		}
+	}
+	return ErrDiscountCodeNotApplicable
+}
+
+func (d DiscountCode) Apply(price int64) int64 {
+	// Compute the discounted price, never going below zero
+	var discounted int64
+	switch d.Kind {
+	case DiscountKindPercentage:
+		discounted = price - price*min(d.Value, 100)/100
+	case DiscountKindFixed:
+		discounted = price - d.Value
+	default:
+		discounted = price
+	}
+	return max(discounted, 0)
+}
+
+func redeemDiscountCode(ctx context.Context, tx *sql.Tx, discountCodeId int64) error {
+	// Count the usage in a single conditional update so concurrent registrations cannot over-redeem the code
+	ctx, span := tracer.Start(ctx, "models.redeemDiscountCode")
+	defer span.End()
+
+	redeemQuery := `
+	UPDATE discount_codes
+	SET used_count = used_count + 1
+	WHERE id = ? AND (max_uses = 0 OR used_count < max_uses)`
+	result, err := tx.ExecContext(ctx, redeemQuery, discountCodeId)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDiscountCodeExhausted
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+)
+
+// useTestDatabase points the models at a new database of their own
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	database.InitDB(filepath.Join(t.TempDir(), "booking.db"))
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+func createTestDiscountCode(t *testing.T, eventId, maxUses int64) DiscountCode {
+	t.Helper()
+	code := DiscountCode{EventId: eventId, Code: "EARLY", Kind: DiscountKindPercentage, Value: 20, MaxUses: maxUses, CreatedAt: time.Now()}
+	if err := code.CreateDiscountCode(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func usedCount(t *testing.T, discountCodeId int64) int64 {
+	t.Helper()
+	var used int64
+	if err := database.DB.QueryRow(`SELECT used_count FROM discount_codes WHERE id = ?`, discountCodeId).Scan(&used); err != nil {
+		t.Fatal(err)
+	}
+	return used
+}
+
+func TestDiscountCodeMaxUses(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	event := Event{Id: 1, Price: 1000}
+	code := createTestDiscountCode(t, event.Id, 2)
+	request := RegistrationRequest{DiscountCode: code.Code}
+
+	for userId := range int64(2) {
+		registration, err := event.RegisterForEvent(ctx, userId+1, request)
+		if err != nil {
+			t.Fatalf("registration %d: %v", userId+1, err)
+		}
+		if registration.AmountPaid != 800 {
+			t.Errorf("registration %d paid %d, want 800", userId+1, registration.AmountPaid)
+		}
+	}
+	if _, err := event.RegisterForEvent(ctx, 3, request); !errors.Is(err, ErrDiscountCodeExhausted) {
+		t.Fatalf("registration past the limit error = %v, want ErrDiscountCodeExhausted", err)
+	}
+	if _, err := GetRegistration(ctx, event.Id, 3); !errors.Is(err, ErrRegistrationNotFound) {
+		t.Errorf("the refused registration was kept: %v", err)
+	}
+	if used := usedCount(t, code.Id); used != 2 {
+		t.Errorf("used count = %d, want 2", used)
+	}
+
+	// Without the code the attendee can still register at full price
+	if registration, err := event.RegisterForEvent(ctx, 3, RegistrationRequest{}); err != nil || registration.AmountPaid != 1000 {
+		t.Errorf("registration without the code = %+v, %v", registration, err)
+	}
+}
+
+func TestConcurrentDiscountCodeRedemptions(t *testing.T) {
+	// More attendees than the code allows race for it, exactly max_uses of them get the discount
+	useTestDatabase(t)
+	ctx := context.Background()
+	event := Event{Id: 1, Price: 1000}
+	code := createTestDiscountCode(t, event.Id, 5)
+
+	const attendees = 20
+	errs := make(chan error, attendees)
+	var registrations sync.WaitGroup
+	for userId := range int64(attendees) {
+		registrations.Add(1)
+		go func() {
+			defer registrations.Done()
+			_, err := event.RegisterForEvent(ctx, userId+1, RegistrationRequest{DiscountCode: code.Code})
+			errs <- err
+		}()
+	}
+	registrations.Wait()
+	close(errs)
+
+	var redeemed, exhausted int
+	for err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case errors.Is(err, ErrDiscountCodeExhausted):
+			exhausted++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if redeemed != 5 || exhausted != attendees-5 {
+		t.Errorf("%d redeemed and %d exhausted, want 5 and %d", redeemed, exhausted, attendees-5)
+	}
+	if used := usedCount(t, code.Id); used != 5 {
+		t.Errorf("used count = %d, want 5", used)
+	}
+}
@@ -1,36 +1,111 @@
 package models
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/ftilie/go-booking-api/apperrors"
 	"github.com/ftilie/go-booking-api/database"
 )
 
+var (
+	ErrEventNotFound        = apperrors.NotFound("event_not_found", "Event not found")
+	ErrEventEnded           = apperrors.Conflict("event_ended", "Cannot update an event that has already ended")
+	ErrNotOrganizer         = apperrors.Forbidden("not_organizer", "Only the organizer of the event can do this")
+	ErrAlreadyRegistered    = apperrors.Conflict("already_registered", "You are already registered for this event")
+	ErrRegistrationNotFound = apperrors.NotFound("registration_not_found", "Registration not found")
+	ErrAlreadyCheckedIn     = apperrors.Conflict("already_checked_in", "Attendee has already checked in")
+	ErrVersionMismatch      = apperrors.PreconditionFailed("version_mismatch", "The event was changed by someone else, fetch it again and retry")
+)
+
 type Event struct {
 	Id          int64
-	Title       string `binding:"required"`
-	Description string
-	Location    string
-	StartTime   time.Time `binding:"required"`
-	EndTime     time.Time `binding:"required"`
+	Title       string    `binding:"required,notblank,max=200"`
+	Description string    `binding:"max=5000"`
+	Location    string    `binding:"max=200"`
+	StartTime   time.Time `binding:"required,future"`
+	EndTime     time.Time `binding:"required,gtfield=StartTime"`
 	Organizer   int64
 	Attendees   []int64
+	Price       int64 `binding:"min=0"` // Ticket price in the smallest currency unit (e.g. cents)
 	CreatedAt   time.Time
 	UpdatedAt   *time.Time
 	DeletedAt   *time.Time // Nullable field for soft delete
+
+	CancellationPolicy *CancellationPolicy
+
+	Sequence int64 // Revision number published to calendar clients, bumped on every update
+	Version  int64 // Bumped on every change to the event or its attendees, used for ETags and optimistic concurrency
+}
+
+// EventChanges holds the event fields that can still be changed once the event exists.
+// Ownership, attendees and timestamps are managed by the API and are deliberately left out.
+type EventChanges struct {
+	Title       string    `json:"title" binding:"required,notblank,max=200"`
+	Description string    `json:"description" binding:"max=5000"`
+	Location    string    `json:"location" binding:"max=200"`
+	StartTime   time.Time `json:"startTime" binding:"required"`
+	EndTime     time.Time `json:"endTime" binding:"required,gtfield=StartTime"`
+	Price       int64     `json:"price" binding:"min=0"`
+}
+
+func (e *Event) Changes() EventChanges {
+	// The current values of the mutable fields, patches are applied on top of them
+	return EventChanges{
+		Title:       e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		StartTime:   e.StartTime,
+		EndTime:     e.EndTime,
+		Price:       e.Price,
+	}
+}
+
+func (e *Event) ApplyChanges(changes EventChanges) {
+	e.Title = changes.Title
+	e.Description = changes.Description
+	e.Location = changes.Location
+	e.StartTime = changes.StartTime
+	e.EndTime = changes.EndTime
+	e.Price = changes.Price
+}
+
+const eventColumns = `id, title, description, location, start_time, end_time, organizer, price, sequence, version, created_at, updated_at, deleted_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEvent(row rowScanner) (Event, error) {
+	var event Event
+	err := row.Scan(&event.Id, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.Organizer, &event.Price, &event.Sequence, &event.Version, &event.CreatedAt, &event.UpdatedAt, &event.DeletedAt)
+	return event, err
+}
+
+func (e Event) AuthorizeOrganizer(userId int64) error {
+	// Only the organizer may change the event or see its private details
+	if e.Organizer != userId {
+		return ErrNotOrganizer
+	}
+	return nil
 }
 
-func (e *Event) CreateEvent() error {
+func (e *Event) CreateEvent(ctx context.Context) error {
 	// Save the event to the database
+	ctx, span := tracer.Start(ctx, "models.CreateEvent")
+	defer span.End()
+
 	eventQuery := `
-	INSERT INTO events (title, description, location, start_time, end_time, organizer, created_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?)`
-	eventStmt, err := database.DB.Prepare(eventQuery)
+	INSERT INTO events (title, description, location, start_time, end_time, organizer, price, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	eventStmt, err := database.DB.PrepareContext(ctx, eventQuery)
 	if err != nil {
 		return err
 	}
 	defer eventStmt.Close()
-	eventResult, err := eventStmt.Exec(e.Title, e.Description, e.Location, e.StartTime, e.EndTime, e.Organizer, e.CreatedAt)
+	eventResult, err := eventStmt.ExecContext(ctx, e.Title, e.Description, e.Location, e.StartTime, e.EndTime, e.Organizer, e.Price, e.CreatedAt)
 	if err != nil {
 		return err
 	}
@@ -41,19 +116,69 @@ func (e *Event) CreateEvent() error {
 	}
 
 	e.Id = id
+	e.Version = 1
+
+	if e.CancellationPolicy != nil {
+		return e.saveCancellationPolicy(ctx, database.DB, *e.CancellationPolicy)
+	}
 	return nil
 }
 
-func getAttendees(eventId int64) ([]int64, error) {
+func CreateEvents(ctx context.Context, events []Event) error {
+	// Save all the events in a single transaction, either every event is created or none is
+	ctx, span := tracer.Start(ctx, "models.CreateEvents")
+	defer span.End()
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	eventQuery := `
+	INSERT INTO events (title, description, location, start_time, end_time, organizer, price, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	eventStmt, err := tx.PrepareContext(ctx, eventQuery)
+	if err != nil {
+		return err
+	}
+	defer eventStmt.Close()
+
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		eventResult, err := eventStmt.ExecContext(ctx, e.Title, e.Description, e.Location, e.StartTime, e.EndTime, e.Organizer, e.Price, e.CreatedAt)
+		if err != nil {
+			return err
+		}
+		ids[i], err = eventResult.LastInsertId()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].Id = ids[i]
+		events[i].Version = 1
+	}
+	return nil
+}
+
+func getAttendees(ctx context.Context, eventId int64) ([]int64, error) {
+	ctx, span := tracer.Start(ctx, "models.getAttendees")
+	defer span.End()
+
 	attendeesQuery := `SELECT user_id FROM event_attendees WHERE event_id = ?`
-	attendeesStmt, err := database.DB.Prepare(attendeesQuery)
+	attendeesStmt, err := database.DB.PrepareContext(ctx, attendeesQuery)
 	if err != nil {
 		return nil, err
 	}
 	defer attendeesStmt.Close()
 	// Fetch attendees for the event
 	var attendees []int64
-	attendeesRows, err := attendeesStmt.Query(eventId)
+	attendeesRows, err := attendeesStmt.QueryContext(ctx, eventId)
 	if err != nil {
 		return nil, err
 	}
@@ -69,14 +194,22 @@ func getAttendees(eventId int64) ([]int64, error) {
 	return attendees, nil
 }
 
-func GetEvents() ([]Event, error) {
-	eventsQuery := `SELECT * FROM events WHERE deleted_at IS NULL`
-	eventsStmt, err := database.DB.Prepare(eventsQuery)
+func GetEvents(ctx context.Context) ([]Event, error) {
+	ctx, span := tracer.Start(ctx, "models.GetEvents")
+	defer span.End()
+
+	policies, err := getCancellationPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsQuery := `SELECT ` + eventColumns + ` FROM events WHERE deleted_at IS NULL`
+	eventsStmt, err := database.DB.PrepareContext(ctx, eventsQuery)
 	if err != nil {
 		return nil, err
 	}
 	defer eventsStmt.Close()
-	eventsRows, err := eventsStmt.Query()
+	eventsRows, err := eventsStmt.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -84,44 +217,94 @@ func GetEvents() ([]Event, error) {
 
 	var events []Event
 	for eventsRows.Next() {
-		var event Event
-		err := eventsRows.Scan(&event.Id, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.Organizer, &event.CreatedAt, &event.UpdatedAt, &event.DeletedAt)
+		event, err := scanEvent(eventsRows)
 		if err != nil {
 			return nil, err
 		}
 
-		attendees, err := getAttendees(event.Id)
+		attendees, err := getAttendees(ctx, event.Id)
 		if err != nil {
 			return nil, err
 		}
 		// Assign attendees to the event
 		event.Attendees = attendees
+
+		event.CancellationPolicy = policies[event.Id]
 		events = append(events, event)
 	}
 	return events, nil
 }
 
-func GetEvent(eventId int64) (*Event, error) {
-	query := `SELECT * FROM events WHERE id = ? AND deleted_at IS NULL`
-	row := database.DB.QueryRow(query, eventId)
-	var event Event
-	err := row.Scan(&event.Id, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.Organizer, &event.CreatedAt, &event.UpdatedAt, &event.DeletedAt)
+func GetEvent(ctx context.Context, eventId int64) (*Event, error) {
+	ctx, span := tracer.Start(ctx, "models.GetEvent")
+	defer span.End()
+
+	query := `SELECT ` + eventColumns + ` FROM events WHERE id = ? AND deleted_at IS NULL`
+	row := database.DB.QueryRowContext(ctx, query, eventId)
+	event, err := scanEvent(row)
 	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			return nil, nil // Event not found
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEventNotFound
 		}
 		return nil, err
 	}
-	attendees, err := getAttendees(eventId)
+	attendees, err := getAttendees(ctx, eventId)
 	if err != nil {
 		return nil, err
 	}
 	event.Attendees = attendees
+
+	policy, err := getCancellationPolicy(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+	event.CancellationPolicy = policy
 	return &event, nil
 }
 
-func (e *Event) UpdateEvent() error {
+const (
+	CalendarFeedHistory = 90 * 24 * time.Hour // Events that ended longer ago are left out of the calendar feed
+	CalendarFeedLimit   = 1000                // Most events in a calendar feed, the ones starting last are left out
+)
+
+func GetCalendarEvents(ctx context.Context, userId int64) ([]Event, error) {
+	// Fetch the events the user organizes or is registered for that have not ended before the feed history.
+	// Deleted events are included so calendar clients can mark them as cancelled.
+	ctx, span := tracer.Start(ctx, "models.GetCalendarEvents")
+	defer span.End()
+
+	eventsQuery := `SELECT ` + eventColumns + ` FROM events
+	WHERE (organizer = ? OR id IN (SELECT event_id FROM event_attendees WHERE user_id = ?))
+		AND end_time >= ?
+	ORDER BY start_time
+	LIMIT ?`
+	eventsStmt, err := database.DB.PrepareContext(ctx, eventsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer eventsStmt.Close()
+	eventsRows, err := eventsStmt.QueryContext(ctx, userId, userId, time.Now().UTC().Add(-CalendarFeedHistory), CalendarFeedLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer eventsRows.Close()
+
+	var events []Event
+	for eventsRows.Next() {
+		event, err := scanEvent(eventsRows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (e *Event) UpdateEvent(ctx context.Context) error {
 	// Update the event in the database
+	ctx, span := tracer.Start(ctx, "models.UpdateEvent")
+	defer span.End()
+
 	eventQuery := `
 	UPDATE events
 	SET title = ?,
@@ -129,69 +312,216 @@ func (e *Event) UpdateEvent() error {
 		location = ?,
 		start_time = ?,
 		end_time = ?,
+		price = ?,
 		created_at = ?,
-		updated_at = ?
-	WHERE id = ?`
-	eventStmt, err := database.DB.Prepare(eventQuery)
+		updated_at = ?,
+		sequence = sequence + 1,
+		version = version + 1
+	WHERE id = ? AND version = ?`
+	eventStmt, err := database.DB.PrepareContext(ctx, eventQuery)
 	if err != nil {
 		return err
 	}
 	defer eventStmt.Close()
-	_, err = eventStmt.Exec(e.Title, e.Description, e.Location, e.StartTime, e.EndTime, e.CreatedAt, e.UpdatedAt, e.Id)
+	result, err := eventStmt.ExecContext(ctx, e.Title, e.Description, e.Location, e.StartTime, e.EndTime, e.Price, e.CreatedAt, e.UpdatedAt, e.Id, e.Version)
 	if err != nil {
 		return err
 	}
+	if err := checkVersionUpdated(result); err != nil {
+		return err
+	}
 
+	e.Sequence++
+	e.Version++
 	return nil
 }
 
-func (e *Event) DeleteEvent() error {
+func (e *Event) DeleteEvent(ctx context.Context) error {
 	// Update the event in the database
+	ctx, span := tracer.Start(ctx, "models.DeleteEvent")
+	defer span.End()
+
 	eventQuery := `
 	UPDATE events
-	SET	deleted_at = ?
-	WHERE id = ?`
-	eventStmt, err := database.DB.Prepare(eventQuery)
+	SET	deleted_at = ?,
+		sequence = sequence + 1,
+		version = version + 1
+	WHERE id = ? AND version = ?`
+	eventStmt, err := database.DB.PrepareContext(ctx, eventQuery)
 	if err != nil {
 		return err
 	}
 	defer eventStmt.Close()
-	_, err = eventStmt.Exec(e.DeletedAt, e.Id)
+	result, err := eventStmt.ExecContext(ctx, e.DeletedAt, e.Id, e.Version)
 	if err != nil {
 		return err
 	}
+	if err := checkVersionUpdated(result); err != nil {
+		return err
+	}
+	e.Sequence++
+	e.Version++
 	return nil
 }
 
-func (e Event) RegisterForEvent(userId int64) error {
-	// Logic to register the user for the event
-	attendeeQuery := `
-	INSERT INTO event_attendees (event_id, user_id)
-	VALUES (?, ?)`
-	attendeeStmt, err := database.DB.Prepare(attendeeQuery)
+func checkVersionUpdated(result sql.Result) error {
+	// Conditional updates touch no row when someone else changed the event since it was read
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	defer attendeeStmt.Close()
-	_, err = attendeeStmt.Exec(e.Id, userId)
-	if err != nil {
-		return err
+	if affected == 0 {
+		return ErrVersionMismatch
 	}
 	return nil
 }
 
-func (e Event) CancelRegistration(userId int64) error {
-	// Logic to cancel the user's registration for the event
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func bumpVersion(ctx context.Context, db execer, eventId int64) error {
+	// Changes made next to the event row, like its attendees or policy, still change the event's version
+	_, err := db.ExecContext(ctx, `UPDATE events SET version = version + 1 WHERE id = ?`, eventId)
+	return err
+}
+
+func (e Event) RegisterForEvent(ctx context.Context, userId int64, request RegistrationRequest) (*Registration, error) {
+	// Logic to register the user for the event, recording the price paid after any discount.
+	// Everything runs in one transaction so a failed registration does not consume the discount code.
+	ctx, span := tracer.Start(ctx, "models.RegisterForEvent")
+	defer span.End()
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	registration := Registration{
+		EventId:      e.Id,
+		UserId:       userId,
+		AmountPaid:   e.Price,
+		TicketTypeId: request.TicketTypeId,
+		CreatedAt:    &now,
+	}
+
+	if request.TicketTypeId != nil {
+		ticketType, err := getTicketType(ctx, tx, e.Id, *request.TicketTypeId)
+		if err != nil {
+			return nil, err
+		}
+		registration.AmountPaid = ticketType.Price
+	}
+
+	if request.DiscountCode != "" {
+		discountCode, err := getDiscountCodeByCode(ctx, tx, e.Id, request.DiscountCode)
+		if err != nil {
+			return nil, err
+		}
+		if err := discountCode.checkApplicable(request.TicketTypeId, now); err != nil {
+			return nil, err
+		}
+		if err := redeemDiscountCode(ctx, tx, discountCode.Id); err != nil {
+			return nil, err
+		}
+		registration.AmountPaid = discountCode.Apply(registration.AmountPaid)
+		registration.DiscountCodeId = &discountCode.Id
+	}
+
 	attendeeQuery := `
-	DELETE FROM event_attendees WHERE event_id = ? AND user_id = ?`
-	attendeeStmt, err := database.DB.Prepare(attendeeQuery)
+	INSERT INTO event_attendees (event_id, user_id, amount_paid, ticket_type_id, discount_code_id, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, attendeeQuery, registration.EventId, registration.UserId, registration.AmountPaid, registration.TicketTypeId, registration.DiscountCodeId, registration.CreatedAt)
+	if database.IsUniqueViolation(err) {
+		return nil, ErrAlreadyRegistered
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := bumpVersion(ctx, tx, e.Id); err != nil {
+		return nil, err
 	}
-	defer attendeeStmt.Close()
-	_, err = attendeeStmt.Exec(e.Id, userId)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
+
+func (e Event) CancelRegistration(ctx context.Context, userId int64) (*Refund, error) {
+	// Logic to cancel the user's registration for the event.
+	// Paid registrations are refunded according to the event's cancellation policy.
+	ctx, span := tracer.Start(ctx, "models.CancelRegistration")
+	defer span.End()
+
+	// The lookup, the removal and the version bump run in one transaction, and only the cancellation
+	// that actually removed the registration goes on to refund it, so concurrent cancellations refund once
+	tx, err := database.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer tx.Rollback()
+
+	registration, err := getRegistration(ctx, tx, e.Id, userId)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM event_attendees WHERE event_id = ? AND user_id = ?`, e.Id, userId)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrRegistrationNotFound
+	}
+	if err := bumpVersion(ctx, tx, e.Id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if registration.AmountPaid == 0 {
+		return nil, nil
+	}
+
+	var policy CancellationPolicy
+	if e.CancellationPolicy != nil {
+		policy = *e.CancellationPolicy
+	}
+	amount := policy.RefundAmount(registration.AmountPaid, e.StartTime, time.Now())
+	if amount == 0 {
+		return nil, nil
+	}
+	return issueRefund(ctx, e.Id, userId, amount, RefundReasonCancelledByAttendee)
+}
+
+func (e Event) RefundAttendees(ctx context.Context) ([]Refund, error) {
+	// Logic to fully refund every paid registration when the organizer cancels the event
+	ctx, span := tracer.Start(ctx, "models.RefundAttendees")
+	defer span.End()
+
+	registrations, err := getPaidRegistrations(ctx, e.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every attendee gets a refund even when some fail, the event is already cancelled
+	var refunds []Refund
+	var failed []error
+	for _, registration := range registrations {
+		refund, err := issueRefund(ctx, e.Id, registration.UserId, registration.AmountPaid, RefundReasonCancelledByOrganizer)
+		if err != nil {
+			failed = append(failed, err)
+		}
+		if refund != nil {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds, errors.Join(failed...)
 }
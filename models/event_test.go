@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func FuzzEventBinding(f *testing.F) {
+	// Whatever the body, binding an event either fails or yields an event that satisfies its rules
+	validation.Register()
+	f.Add([]byte(`{"Title":"Go meetup","StartTime":"2999-01-01T10:00:00Z","EndTime":"2999-01-01T12:00:00Z","Price":1500}`))
+	f.Add([]byte(`{"Title":"   ","StartTime":"2999-01-01T10:00:00Z","EndTime":"2999-01-01T12:00:00Z"}`))
+	f.Add([]byte(`{"Title":"Go meetup","StartTime":"2000-01-01T10:00:00Z","EndTime":"2000-01-01T12:00:00Z"}`))
+	f.Add([]byte(`{"Title":"Go meetup","StartTime":"2999-01-01T10:00:00+14:00","EndTime":"2999-01-01T00:00:00-12:00"}`))
+	f.Add([]byte(`{"Title":"Go meetup","StartTime":"2999-01-01T10:00:00Z","EndTime":"2999-01-01T12:00:00Z","Price":-1}`))
+	f.Add([]byte(`{"Title":"Go meetup","StartTime":"2999-01-01T10:00:00Z","EndTime":"2999-01-01T12:00:00Z","CancellationPolicy":{"FullRefundDays":-1}}`))
+	f.Add([]byte(`{"title":"lower case","startTime":"2999-01-01T10:00:00Z","endTime":"2999-01-01T12:00:00Z","Attendees":[1,2]}`))
+	f.Add([]byte(`{"Title":1,"StartTime":null}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var event Event
+		if err := binding.JSON.BindBody(body, &event); err != nil {
+			return
+		}
+
+		if strings.TrimSpace(event.Title) == "" || utf8.RuneCountInString(event.Title) > 200 {
+			t.Fatalf("accepted title %q", event.Title)
+		}
+		if utf8.RuneCountInString(event.Description) > 5000 || utf8.RuneCountInString(event.Location) > 200 {
+			t.Fatalf("accepted an oversized description or location from %s", body)
+		}
+		if !event.StartTime.After(time.Now().Add(-time.Minute)) {
+			t.Fatalf("accepted start time %v in the past", event.StartTime)
+		}
+		if !event.EndTime.After(event.StartTime) {
+			t.Fatalf("accepted end time %v before start time %v", event.EndTime, event.StartTime)
+		}
+		if event.Price < 0 {
+			t.Fatalf("accepted price %d", event.Price)
+		}
+		if policy := event.CancellationPolicy; policy != nil {
+			if policy.FullRefundDays < 0 || policy.PartialRefundDays < 0 || policy.PartialRefundDays > policy.FullRefundDays ||
+				policy.PartialRefundPercent < 0 || policy.PartialRefundPercent > 100 {
+				t.Fatalf("accepted cancellation policy %+v", *policy)
+			}
+		}
+	})
+}
+
+func TestCalendarEventsWindow(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	create := func(title string, end time.Time, organizer int64) {
+		t.Helper()
+		event := Event{Title: title, StartTime: end.Add(-time.Hour), EndTime: end, Organizer: organizer, CreatedAt: now}
+		if err := event.CreateEvent(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("long past", now.Add(-CalendarFeedHistory-24*time.Hour), 1)
+	create("recent", now.Add(-24*time.Hour), 1)
+	create("upcoming", now.Add(24*time.Hour), 1)
+	create("someone else's", now.Add(24*time.Hour), 2)
+
+	events, err := GetCalendarEvents(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, event := range events {
+		titles = append(titles, event.Title)
+	}
+	if strings.Join(titles, ", ") != "recent, upcoming" {
+		t.Errorf("got events %q, want the recent and upcoming ones in order", titles)
+	}
+}
+
+func TestCalendarEventsLimit(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	start := time.Now().UTC().Add(24 * time.Hour)
+	for i := range CalendarFeedLimit + 5 {
+		event := Event{Title: "Go meetup", StartTime: start.Add(time.Duration(i) * time.Hour), EndTime: start.Add(time.Duration(i+1) * time.Hour), Organizer: 1}
+		if err := event.CreateEvent(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := GetCalendarEvents(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != CalendarFeedLimit || !events[len(events)-1].StartTime.Before(start.Add(CalendarFeedLimit*time.Hour)) {
+		t.Errorf("got %d events, want the first %d to start", len(events), CalendarFeedLimit)
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+)
+
+// IdempotencyKeyTTL is how long a stored response is replayed for retries with the same key
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKey records the request made with a client supplied key and, once it completed, its response.
+// A zero Status means the first request is still being processed.
+type IdempotencyKey struct {
+	UserId      int64
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+func (k IdempotencyKey) Completed() bool {
+	return k.Status != 0
+}
+
+func ReserveIdempotencyKey(ctx context.Context, userId int64, key, fingerprint string) (*IdempotencyKey, bool, error) {
+	// Claim the key for a new request. When the key is already claimed the existing record is returned
+	// instead, and the boolean is false. Expired records are replaced as if they never existed.
+	ctx, span := tracer.Start(ctx, "models.ReserveIdempotencyKey")
+	defer span.End()
+
+	now := time.Now().UTC() // Stored as text, a single time zone keeps them comparable
+	_, err := database.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ? AND key = ? AND created_at < ?`, userId, key, now.Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return nil, false, err
+	}
+
+	record := IdempotencyKey{UserId: userId, Key: key, Fingerprint: fingerprint, CreatedAt: now}
+	insertQuery := `
+	INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at)
+	VALUES (?, ?, ?, ?)`
+	_, err = database.DB.ExecContext(ctx, insertQuery, record.UserId, record.Key, record.Fingerprint, record.CreatedAt)
+	if err == nil {
+		return &record, true, nil
+	}
+	if !database.IsUniqueViolation(err) {
+		return nil, false, err
+	}
+
+	existing, err := getIdempotencyKey(ctx, userId, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func getIdempotencyKey(ctx context.Context, userId int64, key string) (*IdempotencyKey, error) {
+	query := `
+	SELECT user_id, key, fingerprint, status, content_type, body, created_at
+	FROM idempotency_keys WHERE user_id = ? AND key = ?`
+	var record IdempotencyKey
+	var contentType sql.NullString
+	err := database.DB.QueryRowContext(ctx, query, userId, key).Scan(&record.UserId, &record.Key, &record.Fingerprint, &record.Status, &contentType, &record.Body, &record.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("idempotency key disappeared while it was being read")
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.ContentType = contentType.String
+	return &record, nil
+}
+
+func (k *IdempotencyKey) Complete(ctx context.Context, status int, contentType string, body []byte) error {
+	// Store the response so retries with the same key get it back
+	ctx, span := tracer.Start(ctx, "models.CompleteIdempotencyKey")
+	defer span.End()
+
+	query := `
+	UPDATE idempotency_keys SET status = ?, content_type = ?, body = ?
+	WHERE user_id = ? AND key = ?`
+	_, err := database.DB.ExecContext(ctx, query, status, contentType, body, k.UserId, k.Key)
+	if err != nil {
+		return err
+	}
+	k.Status = status
+	k.ContentType = contentType
+	k.Body = body
+	return nil
+}
+
+func (k *IdempotencyKey) Release(ctx context.Context) error {
+	// Forget the key of a request that failed on our side so the client can retry it
+	ctx, span := tracer.Start(ctx, "models.ReleaseIdempotencyKey")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ? AND key = ?`, k.UserId, k.Key)
+	return err
+}
+
+func DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "models.DeleteExpiredIdempotencyKeys")
+	defer span.End()
+
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < ?`, time.Now().UTC().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
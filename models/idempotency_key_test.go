@@ -0,0 +1,32 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeysIgnoreTimeZone(t *testing.T) {
+	// Timestamps are compared as text, a key stored by an instance in another time zone must not look expired
+	useTestDatabase(t)
+	local := time.Local
+	t.Cleanup(func() { time.Local = local })
+	ctx := context.Background()
+
+	time.Local = time.FixedZone("UTC-12", -12*60*60)
+	if _, reserved, err := ReserveIdempotencyKey(ctx, 1, "key", "fingerprint"); err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey = %v, %v", reserved, err)
+	}
+
+	time.Local = time.FixedZone("UTC+14", 14*60*60)
+	deleted, err := DeleteExpiredIdempotencyKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Errorf("deleted %d keys reserved a moment ago", deleted)
+	}
+	if _, reserved, err := ReserveIdempotencyKey(ctx, 1, "key", "fingerprint"); err != nil || reserved {
+		t.Errorf("ReserveIdempotencyKey reserved the key again (%v), want the existing record", err)
+	}
+}
@@ -0,0 +1,328 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/payments"
+)
+
+const (
+	RefundStatusPending   = "pending" // Recorded, the provider has not confirmed it yet
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+
+	RefundReasonCancelledByAttendee  = "cancelled_by_attendee"
+	RefundReasonCancelledByOrganizer = "cancelled_by_organizer"
+)
+
+const (
+	maxRefundAttempts    = 10               // Refunds still failing after this many attempts are left for an operator
+	refundPendingTimeout = 10 * time.Minute // Pending refunds older than this were interrupted before the provider answered
+	refundRetryBatch     = 100
+	refundRetryTimeout   = 5 * time.Minute
+)
+
+// CancellationPolicy decides how much of the amount paid is refunded when an attendee cancels.
+// Cancelling at least FullRefundDays before the event starts refunds everything, at least
+// PartialRefundDays before refunds PartialRefundPercent, and later cancellations refund nothing.
+// The zero value refunds everything until the event starts.
+type CancellationPolicy struct {
+	FullRefundDays       int64 `binding:"min=0"`
+	PartialRefundDays    int64 `binding:"min=0,ltefield=FullRefundDays"`
+	PartialRefundPercent int64 `binding:"min=0,max=100"`
+}
+
+type Refund struct {
+	Id                int64
+	EventId           int64
+	UserId            int64
+	Amount            int64
+	Reason            string
+	Status            string
+	ProviderReference string
+	CreatedAt         time.Time
+}
+
+func (p CancellationPolicy) RefundAmount(amountPaid int64, startTime time.Time, cancelledAt time.Time) int64 {
+	// Compute the refundable part of the amount paid when cancelling at the given time
+	timeLeft := startTime.Sub(cancelledAt)
+	if timeLeft < 0 {
+		return 0
+	}
+	if timeLeft >= days(p.FullRefundDays) {
+		return amountPaid
+	}
+	if timeLeft >= days(p.PartialRefundDays) {
+		return amountPaid * p.PartialRefundPercent / 100
+	}
+	return 0
+}
+
+func days(count int64) time.Duration {
+	return time.Duration(count) * 24 * time.Hour
+}
+
+func getCancellationPolicy(ctx context.Context, eventId int64) (*CancellationPolicy, error) {
+	ctx, span := tracer.Start(ctx, "models.getCancellationPolicy")
+	defer span.End()
+
+	query := `
+	SELECT full_refund_days, partial_refund_days, partial_refund_percent
+	FROM cancellation_policies WHERE event_id = ?`
+	var policy CancellationPolicy
+	err := database.DB.QueryRowContext(ctx, query, eventId).Scan(&policy.FullRefundDays, &policy.PartialRefundDays, &policy.PartialRefundPercent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No policy configured for the event
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func getCancellationPolicies(ctx context.Context) (map[int64]*CancellationPolicy, error) {
+	// Load the policies of every listed event at once, events without one are missing from the map
+	ctx, span := tracer.Start(ctx, "models.getCancellationPolicies")
+	defer span.End()
+
+	query := `
+	SELECT event_id, full_refund_days, partial_refund_days, partial_refund_percent
+	FROM cancellation_policies
+	WHERE event_id IN (SELECT id FROM events WHERE deleted_at IS NULL)`
+	rows, err := database.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := map[int64]*CancellationPolicy{}
+	for rows.Next() {
+		var eventId int64
+		var policy CancellationPolicy
+		if err := rows.Scan(&eventId, &policy.FullRefundDays, &policy.PartialRefundDays, &policy.PartialRefundPercent); err != nil {
+			return nil, err
+		}
+		policies[eventId] = &policy
+	}
+	return policies, rows.Err()
+}
+
+func (e *Event) SaveCancellationPolicy(ctx context.Context, policy CancellationPolicy) error {
+	// Create or replace the cancellation policy of the event, which counts as a change of the event.
+	// Like UpdateEvent it only applies to the version that was read, ErrVersionMismatch means someone changed it since.
+	ctx, span := tracer.Start(ctx, "models.SaveCancellationPolicy")
+	defer span.End()
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE events SET version = version + 1 WHERE id = ? AND version = ?`, e.Id, e.Version)
+	if err != nil {
+		return err
+	}
+	if err := checkVersionUpdated(result); err != nil {
+		return err
+	}
+	if err := e.saveCancellationPolicy(ctx, tx, policy); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	e.Version++
+	return nil
+}
+
+func (e *Event) saveCancellationPolicy(ctx context.Context, db execer, policy CancellationPolicy) error {
+	policyQuery := `
+	INSERT INTO cancellation_policies (event_id, full_refund_days, partial_refund_days, partial_refund_percent)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (event_id) DO UPDATE SET
+		full_refund_days = excluded.full_refund_days,
+		partial_refund_days = excluded.partial_refund_days,
+		partial_refund_percent = excluded.partial_refund_percent`
+	_, err := db.ExecContext(ctx, policyQuery, e.Id, policy.FullRefundDays, policy.PartialRefundDays, policy.PartialRefundPercent)
+	if err != nil {
+		return err
+	}
+
+	e.CancellationPolicy = &policy
+	return nil
+}
+
+func (r *Refund) save(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "models.saveRefund")
+	defer span.End()
+
+	refundQuery := `
+	INSERT INTO refunds (event_id, user_id, amount, reason, status, provider_reference, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	refundStmt, err := database.DB.PrepareContext(ctx, refundQuery)
+	if err != nil {
+		return err
+	}
+	defer refundStmt.Close()
+	result, err := refundStmt.ExecContext(ctx, r.EventId, r.UserId, r.Amount, r.Reason, r.Status, r.ProviderReference, r.CreatedAt, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	r.Id = id
+	return nil
+}
+
+func (r *Refund) send(ctx context.Context) error {
+	// Ask the payment provider for the refund and record the outcome.
+	// The refund id goes along so the provider pays a retried refund only once.
+	ctx, span := tracer.Start(ctx, "models.sendRefund")
+	defer span.End()
+
+	status := RefundStatusSucceeded
+	reference, providerErr := payments.Provider.Refund(ctx, payments.RefundRequest{
+		RefundId: r.Id,
+		EventId:  r.EventId,
+		UserId:   r.UserId,
+		Amount:   r.Amount,
+		Reason:   r.Reason,
+	})
+	if providerErr != nil {
+		status = RefundStatusFailed
+	}
+
+	query := `
+	UPDATE refunds
+	SET status = ?, provider_reference = ?, attempts = attempts + 1, updated_at = ?
+	WHERE id = ?`
+	if _, err := database.DB.ExecContext(ctx, query, status, reference, time.Now().UTC(), r.Id); err != nil {
+		return errors.Join(providerErr, err) // Still pending, the retries pick it up
+	}
+	r.Status = status
+	r.ProviderReference = reference
+	return providerErr
+}
+
+func issueRefund(ctx context.Context, eventId, userId, amount int64, reason string) (*Refund, error) {
+	// Record the refund, then send it through the payment provider.
+	// Refunds the provider rejected, or that were interrupted, are retried by RetryRefunds.
+	ctx, span := tracer.Start(ctx, "models.issueRefund")
+	defer span.End()
+
+	refund := Refund{
+		EventId:   eventId,
+		UserId:    userId,
+		Amount:    amount,
+		Reason:    reason,
+		Status:    RefundStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if err := refund.save(ctx); err != nil {
+		return nil, err
+	}
+	return &refund, refund.send(ctx)
+}
+
+func RetryFailedRefunds(ctx context.Context) (int, error) {
+	// Send again the refunds the provider rejected and those left pending by an interruption, returns how many succeeded
+	ctx, span := tracer.Start(ctx, "models.RetryFailedRefunds")
+	defer span.End()
+
+	refundsQuery := `
+	SELECT id, event_id, user_id, amount, reason, status, provider_reference, created_at
+	FROM refunds
+	WHERE attempts < ? AND (status = ? OR (status = ? AND updated_at < ?))
+	ORDER BY id LIMIT ?`
+	refundsRows, err := database.DB.QueryContext(ctx, refundsQuery, maxRefundAttempts, RefundStatusFailed, RefundStatusPending,
+		time.Now().UTC().Add(-refundPendingTimeout), refundRetryBatch)
+	if err != nil {
+		return 0, err
+	}
+	refunds, err := scanRefunds(refundsRows)
+	if err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	var failed []error
+	for _, refund := range refunds {
+		if err := refund.send(ctx); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		succeeded++
+	}
+	return succeeded, errors.Join(failed...)
+}
+
+func RetryRefunds(ctx context.Context, worker *health.Worker, interval time.Duration) {
+	// This function will retry failed refunds every interval until the context is cancelled
+	worker.SetRunning(true)
+	defer worker.SetRunning(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			retryCtx, cancel := context.WithTimeout(ctx, refundRetryTimeout)
+			succeeded, err := RetryFailedRefunds(retryCtx)
+			cancel()
+			if err != nil {
+				logger.Log.Warn("failed to retry some refunds", "succeeded", succeeded, "error", err)
+				continue
+			}
+			logger.Log.Debug("retried failed refunds", "count", succeeded)
+		}
+	}
+}
+
+func GetRefunds(ctx context.Context, eventId int64) ([]Refund, error) {
+	ctx, span := tracer.Start(ctx, "models.GetRefunds")
+	defer span.End()
+
+	refundsQuery := `
+	SELECT id, event_id, user_id, amount, reason, status, provider_reference, created_at
+	FROM refunds WHERE event_id = ?`
+	refundsStmt, err := database.DB.PrepareContext(ctx, refundsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer refundsStmt.Close()
+	refundsRows, err := refundsStmt.QueryContext(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+	return scanRefunds(refundsRows)
+}
+
+func scanRefunds(refundsRows *sql.Rows) ([]Refund, error) {
+	defer refundsRows.Close()
+
+	var refunds []Refund
+	for refundsRows.Next() {
+		var refund Refund
+		var reference sql.NullString
+		err := refundsRows.Scan(&refund.Id, &refund.EventId, &refund.UserId, &refund.Amount, &refund.Reason, &refund.Status, &reference, &refund.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		refund.ProviderReference = reference.String
+		refunds = append(refunds, refund)
+	}
+	return refunds, refundsRows.Err()
+}
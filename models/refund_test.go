@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/payments"
+)
+
+// flakyRefundProvider rejects refunds while down, or those of rejectUser, and records the ids of the refunds it paid
+type flakyRefundProvider struct {
+	down       bool
+	rejectUser int64
+	paid       []int64
+}
+
+func (p *flakyRefundProvider) Refund(ctx context.Context, request payments.RefundRequest) (string, error) {
+	if p.down || request.UserId == p.rejectUser {
+		return "", errors.New("provider unavailable")
+	}
+	p.paid = append(p.paid, request.RefundId)
+	return "ref", nil
+}
+
+func useRefundProvider(t *testing.T, provider payments.RefundProvider) {
+	t.Helper()
+	useTestDatabase(t)
+	previous := payments.Provider
+	payments.Provider = provider
+	t.Cleanup(func() { payments.Provider = previous })
+}
+
+func TestRefundAmount(t *testing.T) {
+	start := time.Date(2026, time.June, 10, 18, 0, 0, 0, time.UTC)
+	policy := CancellationPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50}
+	tests := []struct {
+		name        string
+		policy      CancellationPolicy
+		amountPaid  int64
+		cancelledAt time.Time
+		want        int64
+	}{
+		{"before the full refund window", policy, 1000, start.Add(-30 * 24 * time.Hour), 1000},
+		{"full refund window starts", policy, 1000, start.Add(-14 * 24 * time.Hour), 1000},
+		{"just after the full refund window", policy, 1000, start.Add(-14*24*time.Hour + time.Second), 500},
+		{"partial refund window starts", policy, 1000, start.Add(-7 * 24 * time.Hour), 500},
+		{"just after the partial refund window", policy, 1000, start.Add(-7*24*time.Hour + time.Second), 0},
+		{"event started", policy, 1000, start.Add(time.Hour), 0},
+		{"percentage rounds down", CancellationPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 33}, 999, start.Add(-10 * 24 * time.Hour), 329},
+		{"partial refund of one cent", CancellationPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50}, 1, start.Add(-10 * 24 * time.Hour), 0},
+		{"no policy refunds until the start", CancellationPolicy{}, 1000, start.Add(-time.Minute), 1000},
+		{"no policy after the start", CancellationPolicy{}, 1000, start.Add(time.Minute), 0},
+		{"no partial window", CancellationPolicy{FullRefundDays: 3}, 1000, start.Add(-24 * time.Hour), 0},
+		{"free registration", policy, 0, start.Add(-30 * 24 * time.Hour), 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.RefundAmount(test.amountPaid, start, test.cancelledAt); got != test.want {
+				t.Errorf("RefundAmount(%d) = %d, want %d", test.amountPaid, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryFailedRefunds(t *testing.T) {
+	provider := &flakyRefundProvider{down: true}
+	useRefundProvider(t, provider)
+	ctx := context.Background()
+
+	refund, err := issueRefund(ctx, 1, 2, 1500, RefundReasonCancelledByAttendee)
+	if err == nil || refund == nil || refund.Status != RefundStatusFailed {
+		t.Fatalf("issueRefund = %+v, %v, want a failed refund", refund, err)
+	}
+	if succeeded, err := RetryFailedRefunds(ctx); err == nil || succeeded != 0 {
+		t.Fatalf("RetryFailedRefunds while down = %d, %v, want an error", succeeded, err)
+	}
+
+	provider.down = false
+	if succeeded, err := RetryFailedRefunds(ctx); err != nil || succeeded != 1 {
+		t.Fatalf("RetryFailedRefunds = %d, %v, want 1", succeeded, err)
+	}
+	refunds, err := GetRefunds(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refunds) != 1 || refunds[0].Status != RefundStatusSucceeded || refunds[0].ProviderReference != "ref" {
+		t.Fatalf("got refunds %+v, want the refund succeeded", refunds)
+	}
+	if len(provider.paid) != 1 || provider.paid[0] != refund.Id {
+		t.Errorf("provider paid refunds %v, want only %d", provider.paid, refund.Id)
+	}
+
+	// Succeeded refunds are never sent again
+	if succeeded, err := RetryFailedRefunds(ctx); err != nil || succeeded != 0 {
+		t.Errorf("RetryFailedRefunds after success = %d, %v, want 0", succeeded, err)
+	}
+}
+
+func TestRetryInterruptedRefunds(t *testing.T) {
+	// A refund left pending was interrupted before the provider answered, it is retried once it is old enough
+	provider := &flakyRefundProvider{}
+	useRefundProvider(t, provider)
+	ctx := context.Background()
+
+	refund := Refund{EventId: 1, UserId: 2, Amount: 1500, Reason: RefundReasonCancelledByOrganizer, Status: RefundStatusPending, CreatedAt: time.Now()}
+	if err := refund.save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if succeeded, err := RetryFailedRefunds(ctx); err != nil || succeeded != 0 {
+		t.Fatalf("RetryFailedRefunds = %d, %v, want the recent pending refund left alone", succeeded, err)
+	}
+
+	stale := time.Now().UTC().Add(-2 * refundPendingTimeout)
+	if _, err := database.DB.Exec(`UPDATE refunds SET updated_at = ? WHERE id = ?`, stale, refund.Id); err != nil {
+		t.Fatal(err)
+	}
+	if succeeded, err := RetryFailedRefunds(ctx); err != nil || succeeded != 1 {
+		t.Fatalf("RetryFailedRefunds = %d, %v, want the stale pending refund sent", succeeded, err)
+	}
+}
+
+func TestRefundRetriesGiveUp(t *testing.T) {
+	useRefundProvider(t, &flakyRefundProvider{down: true})
+	ctx := context.Background()
+
+	if _, err := issueRefund(ctx, 1, 2, 1500, RefundReasonCancelledByAttendee); err == nil {
+		t.Fatal("issueRefund succeeded with the provider down")
+	}
+	for range maxRefundAttempts - 1 {
+		RetryFailedRefunds(ctx)
+	}
+	if succeeded, err := RetryFailedRefunds(ctx); err != nil || succeeded != 0 {
+		t.Errorf("RetryFailedRefunds after %d attempts = %d, %v, want nothing left to retry", maxRefundAttempts, succeeded, err)
+	}
+}
+
+func TestRefundAttendeesContinuesAfterFailure(t *testing.T) {
+	// The event is already cancelled, one rejected refund must not keep the other attendees from theirs
+	useRefundProvider(t, &flakyRefundProvider{rejectUser: 2})
+	ctx := context.Background()
+	for userId := range int64(3) {
+		_, err := database.DB.Exec(`INSERT INTO event_attendees (event_id, user_id, amount_paid) VALUES (1, ?, 1000)`, userId+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refunds, err := Event{Id: 1}.RefundAttendees(ctx)
+	if err == nil {
+		t.Error("RefundAttendees did not report the rejected refund")
+	}
+	statuses := map[int64]string{}
+	for _, refund := range refunds {
+		statuses[refund.UserId] = refund.Status
+	}
+	want := map[int64]string{1: RefundStatusSucceeded, 2: RefundStatusFailed, 3: RefundStatusSucceeded}
+	if len(statuses) != len(want) || statuses[1] != want[1] || statuses[2] != want[2] || statuses[3] != want[3] {
+		t.Errorf("got refund statuses %v, want %v", statuses, want)
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+)
+
+type Registration struct {
+	EventId        int64
+	UserId         int64
+	AmountPaid     int64
+	TicketTypeId   *int64
+	DiscountCodeId *int64
+	CreatedAt      *time.Time
+	CheckedInAt    *time.Time
+}
+
+// RegistrationRequest holds the optional choices an attendee makes when registering
+type RegistrationRequest struct {
+	TicketTypeId *int64
+	DiscountCode string
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func GetRegistration(ctx context.Context, eventId, userId int64) (*Registration, error) {
+	ctx, span := tracer.Start(ctx, "models.GetRegistration")
+	defer span.End()
+
+	return getRegistration(ctx, database.DB, eventId, userId)
+}
+
+func getRegistration(ctx context.Context, db rowQueryer, eventId, userId int64) (*Registration, error) {
+	query := `
+	SELECT event_id, user_id, amount_paid, ticket_type_id, discount_code_id, created_at, checked_in_at
+	FROM event_attendees WHERE event_id = ? AND user_id = ?`
+	var registration Registration
+	err := db.QueryRowContext(ctx, query, eventId, userId).Scan(&registration.EventId, &registration.UserId, &registration.AmountPaid, &registration.TicketTypeId, &registration.DiscountCodeId, &registration.CreatedAt, &registration.CheckedInAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRegistrationNotFound
+		}
+		return nil, err
+	}
+	return &registration, nil
+}
+
+func (e Event) CheckIn(ctx context.Context, userId int64) (*Registration, error) {
+	// Logic to record the attendee's arrival, the condition on checked_in_at rejects duplicate check-ins
+	ctx, span := tracer.Start(ctx, "models.CheckIn")
+	defer span.End()
+
+	checkInQuery := `
+	UPDATE event_attendees
+	SET checked_in_at = ?
+	WHERE event_id = ? AND user_id = ? AND checked_in_at IS NULL`
+	checkInStmt, err := database.DB.PrepareContext(ctx, checkInQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer checkInStmt.Close()
+	result, err := checkInStmt.ExecContext(ctx, time.Now(), e.Id, userId)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	registration, err := GetRegistration(ctx, e.Id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return registration, ErrAlreadyCheckedIn
+	}
+	return registration, nil
+}
+
+func getPaidRegistrations(ctx context.Context, eventId int64) ([]Registration, error) {
+	ctx, span := tracer.Start(ctx, "models.getPaidRegistrations")
+	defer span.End()
+
+	registrationsQuery := `
+	SELECT event_id, user_id, amount_paid, ticket_type_id, discount_code_id, created_at, checked_in_at
+	FROM event_attendees WHERE event_id = ? AND amount_paid > 0`
+	registrationsStmt, err := database.DB.PrepareContext(ctx, registrationsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer registrationsStmt.Close()
+	registrationsRows, err := registrationsStmt.QueryContext(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer registrationsRows.Close()
+
+	var registrations []Registration
+	for registrationsRows.Next() {
+		var registration Registration
+		err := registrationsRows.Scan(&registration.EventId, &registration.UserId, &registration.AmountPaid, &registration.TicketTypeId, &registration.DiscountCodeId, &registration.CreatedAt, &registration.CheckedInAt)
+		if err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+	return registrations, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/ftilie/go-booking-api/logger"
+)
+
+const revokedTokenCleanupTimeout = time.Minute
+
+func RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	// Deny the token with this jti until expiresAt, after which it is rejected as expired anyway
+	ctx, span := tracer.Start(ctx, "models.RevokeToken")
+	defer span.End()
+
+	query := `INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`
+	_, err := database.DB.ExecContext(ctx, query, id, expiresAt.UTC())
+	return err
+}
+
+func IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "models.IsTokenRevoked")
+	defer span.End()
+
+	var found int
+	err := database.DB.QueryRowContext(ctx, `SELECT 1 FROM revoked_tokens WHERE id = ?`, id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func DeleteExpiredRevokedTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "models.DeleteExpiredRevokedTokens")
+	defer span.End()
+
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func CleanRevokedTokens(ctx context.Context, worker *health.Worker, interval time.Duration) {
+	// This function will forget revoked tokens once they expired, every interval until the context is cancelled
+	worker.SetRunning(true)
+	defer worker.SetRunning(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanupCtx, cancel := context.WithTimeout(ctx, revokedTokenCleanupTimeout)
+			deleted, err := DeleteExpiredRevokedTokens(cleanupCtx)
+			cancel()
+			if err != nil {
+				logger.Log.Error("failed to delete expired revoked tokens", "error", err)
+				continue
+			}
+			logger.Log.Debug("deleted expired revoked tokens", "count", deleted)
+		}
+	}
+}
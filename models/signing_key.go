@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+)
+
+// SigningKey is a key pair tokens are signed with, stored so every instance of the API signs with the same keys.
+// A key is published as soon as it is created and signs new tokens from ActivatesAt on.
+type SigningKey struct {
+	Id          string // The kid header of the tokens it signed
+	Algorithm   string
+	PrivateKey  []byte // PKCS #8 DER, sealed with AES-GCM when Encrypted
+	Encrypted   bool
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+}
+
+func (k *SigningKey) CreateSigningKey(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "models.CreateSigningKey")
+	defer span.End()
+
+	query := `
+	INSERT INTO signing_keys (id, algorithm, private_key, encrypted, created_at, activates_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := database.DB.ExecContext(ctx, query, k.Id, k.Algorithm, k.PrivateKey, k.Encrypted, k.CreatedAt, k.ActivatesAt)
+	return err
+}
+
+func GetSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	// Returns every stored key, in the order they activate
+	ctx, span := tracer.Start(ctx, "models.GetSigningKeys")
+	defer span.End()
+
+	query := `SELECT id, algorithm, private_key, encrypted, created_at, activates_at FROM signing_keys ORDER BY activates_at, created_at`
+	rows, err := database.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		if err := rows.Scan(&key.Id, &key.Algorithm, &key.PrivateKey, &key.Encrypted, &key.CreatedAt, &key.ActivatesAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func EncryptSigningKey(ctx context.Context, id string, privateKey []byte) error {
+	// Replaces a key stored before encryption was configured with its sealed form, keys already sealed are left alone
+	ctx, span := tracer.Start(ctx, "models.EncryptSigningKey")
+	defer span.End()
+
+	query := `UPDATE signing_keys SET private_key = ?, encrypted = 1 WHERE id = ? AND encrypted = 0`
+	_, err := database.DB.ExecContext(ctx, query, privateKey, id)
+	return err
+}
+
+func DeleteSigningKey(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "models.DeleteSigningKey")
+	defer span.End()
+
+	_, err := database.DB.ExecContext(ctx, `DELETE FROM signing_keys WHERE id = ?`, id)
+	return err
+}
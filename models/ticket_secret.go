@@ -0,0 +1,29 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+)
+
+const ticketSecretSize = 32
+
+func TicketSecret(ctx context.Context) ([]byte, error) {
+	// Returns the key tickets are signed with when none is configured, the first instance to start generates it
+	// and every other one uses the same so tickets stay valid across instances and restarts
+	ctx, span := tracer.Start(ctx, "models.TicketSecret")
+	defer span.End()
+
+	secret := make([]byte, ticketSecretSize)
+	rand.Read(secret)
+	query := `INSERT INTO ticket_secrets (id, secret, created_at) VALUES (1, ?, ?) ON CONFLICT (id) DO NOTHING`
+	if _, err := database.DB.ExecContext(ctx, query, secret, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	var stored []byte
+	err := database.DB.QueryRowContext(ctx, `SELECT secret FROM ticket_secrets WHERE id = 1`).Scan(&stored)
+	return stored, err
+}
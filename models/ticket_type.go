@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/database"
+)
+
+var ErrTicketTypeNotFound = apperrors.NotFound("ticket_type_not_found", "Ticket type not found")
+
+type TicketType struct {
+	Id        int64
+	EventId   int64
+	Name      string `binding:"required,notblank,max=100"`
+	Price     int64  `binding:"min=0"` // Price in the smallest currency unit (e.g. cents)
+	CreatedAt time.Time
+}
+
+func (t *TicketType) CreateTicketType(ctx context.Context) error {
+	// Save the ticket type to the database
+	ctx, span := tracer.Start(ctx, "models.CreateTicketType")
+	defer span.End()
+
+	ticketTypeQuery := `
+	INSERT INTO ticket_types (event_id, name, price, created_at)
+	VALUES (?, ?, ?, ?)`
+	ticketTypeStmt, err := database.DB.PrepareContext(ctx, ticketTypeQuery)
+	if err != nil {
+		return err
+	}
+	defer ticketTypeStmt.Close()
+	result, err := ticketTypeStmt.ExecContext(ctx, t.EventId, t.Name, t.Price, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	t.Id = id
+	return nil
+}
+
+func GetTicketTypes(ctx context.Context, eventId int64) ([]TicketType, error) {
+	ctx, span := tracer.Start(ctx, "models.GetTicketTypes")
+	defer span.End()
+
+	ticketTypesQuery := `
+	SELECT id, event_id, name, price, created_at
+	FROM ticket_types WHERE event_id = ?`
+	ticketTypesStmt, err := database.DB.PrepareContext(ctx, ticketTypesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer ticketTypesStmt.Close()
+	ticketTypesRows, err := ticketTypesStmt.QueryContext(ctx, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer ticketTypesRows.Close()
+
+	var ticketTypes []TicketType
+	for ticketTypesRows.Next() {
+		var ticketType TicketType
+		err := ticketTypesRows.Scan(&ticketType.Id, &ticketType.EventId, &ticketType.Name, &ticketType.Price, &ticketType.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ticketTypes = append(ticketTypes, ticketType)
+	}
+	return ticketTypes, nil
+}
+
+func getTicketType(ctx context.Context, tx *sql.Tx, eventId, ticketTypeId int64) (*TicketType, error) {
+	ctx, span := tracer.Start(ctx, "models.getTicketType")
+	defer span.End()
+
+	query := `
+	SELECT id, event_id, name, price, created_at
+	FROM ticket_types WHERE id = ? AND event_id = ?`
+	var ticketType TicketType
+	err := tx.QueryRowContext(ctx, query, ticketTypeId, eventId).Scan(&ticketType.Id, &ticketType.EventId, &ticketType.Name, &ticketType.Price, &ticketType.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTicketTypeNotFound
+		}
+		return nil, err
+	}
+	return &ticketType, nil
+}
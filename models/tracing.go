@@ -0,0 +1,6 @@
+package models
+
+import "go.opentelemetry.io/otel"
+
+// Every model function opens a span named after itself, the SQL statements it issues are child spans
+var tracer = otel.Tracer("github.com/ftilie/go-booking-api/models")
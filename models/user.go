@@ -1,28 +1,42 @@
 package models
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 
+	"github.com/ftilie/go-booking-api/apperrors"
 	"github.com/ftilie/go-booking-api/database"
 	"github.com/ftilie/go-booking-api/utils"
 )
 
+var (
+	ErrEmailTaken           = apperrors.Conflict("email_taken", "An account already exists for this email")
+	ErrInvalidCredentials   = apperrors.Unauthorized("invalid_credentials", "Invalid email or password")
+	ErrCalendarFeedNotFound = apperrors.NotFound("calendar_feed_not_found", "Calendar feed not found")
+)
+
 type User struct {
 	Id        int64
-	Email     string `binding:"required,email"`
-	Password  string `binding:"required"`
+	Email     string `binding:"required,email,max=254"`
+	Password  string `json:"-" binding:"required"` // Never serialized, so a user can be returned without leaking the hash
 	CreatedAt *time.Time
 	UpdatedAt *time.Time
 	DeletedAt *time.Time // Nullable field for soft delete
 }
 
-func (u *User) CreateUser() error {
+func (u *User) CreateUser(ctx context.Context) error {
 	// Save the user to the database
+	ctx, span := tracer.Start(ctx, "models.CreateUser")
+	defer span.End()
+
 	userQuery := `
 	INSERT INTO users (email, password, created_at)
 	VALUES (?, ?, ?)`
-	userStmt, err := database.DB.Prepare(userQuery)
+	userStmt, err := database.DB.PrepareContext(ctx, userQuery)
 	if err != nil {
 		return err
 	}
@@ -33,7 +47,10 @@ func (u *User) CreateUser() error {
 	if err != nil {
 		return err
 	}
-	result, err := userStmt.Exec(u.Email, hashedPassword, u.CreatedAt)
+	result, err := userStmt.ExecContext(ctx, u.Email, hashedPassword, u.CreatedAt)
+	if database.IsUniqueViolation(err) {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		return err
 	}
@@ -47,22 +64,28 @@ func (u *User) CreateUser() error {
 	return nil
 }
 
-func (u *User) Authenticate() (bool, error) {
+func (u *User) Authenticate(ctx context.Context) (bool, error) {
+	ctx, span := tracer.Start(ctx, "models.Authenticate")
+	defer span.End()
+
 	if u.Email == "" {
-		return false, errors.New("email must be provided")
+		return false, ErrInvalidCredentials
 	}
 
 	// Query for the user using username or email
 	query := `
 		SELECT id, password FROM users WHERE email = ?`
-	stmt, err := database.DB.Prepare(query)
+	stmt, err := database.DB.PrepareContext(ctx, query)
 	if err != nil {
 		return false, err
 	}
 	defer stmt.Close()
 
 	var storedPassword string
-	err = stmt.QueryRow(u.Email).Scan(&u.Id, &storedPassword)
+	err = stmt.QueryRowContext(ctx, u.Email).Scan(&u.Id, &storedPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil // Unknown emails are reported like wrong passwords
+	}
 	if err != nil {
 		return false, err
 	}
@@ -71,3 +94,44 @@ func (u *User) Authenticate() (bool, error) {
 	isValid := utils.CheckPasswordHash(u.Password, storedPassword)
 	return isValid, nil
 }
+
+func (u *User) ResetCalendarToken(ctx context.Context) (string, error) {
+	// Generate a new secret for the user's calendar feed URL, invalidating the previous one
+	ctx, span := tracer.Start(ctx, "models.ResetCalendarToken")
+	defer span.End()
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(secret)
+
+	query := `UPDATE users SET calendar_token = ? WHERE id = ?`
+	stmt, err := database.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, token, u.Id)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func GetUserIdByCalendarToken(ctx context.Context, token string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "models.GetUserIdByCalendarToken")
+	defer span.End()
+
+	query := `SELECT id FROM users WHERE calendar_token = ? AND deleted_at IS NULL`
+	var userId int64
+	err := database.DB.QueryRowContext(ctx, query, token).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrCalendarFeedNotFound
+		}
+		return 0, err
+	}
+	return userId, nil
+}
@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Spec is the OpenAPI 3 document describing every route of the API, keep it in sync with routes.RegisterRoutes
+//
+//go:embed openapi.json
+var Spec []byte
+
+// The Swagger UI bundle loads this file to know which document to render
+const initializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+func DocsHandler() http.Handler {
+	// This function will serve the bundled Swagger UI, pointed at the document served at /openapi.json.
+	// Requests are expected with the mount prefix already stripped.
+	files := http.FileServerFS(swaggerFiles.FS)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if strings.TrimPrefix(request.URL.Path, "/") == "swagger-initializer.js" {
+			writer.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			writer.Write([]byte(initializer))
+			return
+		}
+		files.ServeHTTP(writer, request)
+	})
+}
+
+// Operation is the part of an OpenAPI operation the contract test needs
+type Operation struct {
+	OperationId string `json:"operationId"`
+}
+
+func Paths() (map[string]map[string]Operation, error) {
+	// This function will list the operations of the document by path and lower case method
+	var document struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Spec, &document); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]map[string]Operation, len(document.Paths))
+	for path, item := range document.Paths {
+		paths[path] = map[string]Operation{}
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var operation Operation
+			if err := json.Unmarshal(raw, &operation); err != nil {
+				return nil, err
+			}
+			paths[path][method] = operation
+		}
+	}
+	return paths, nil
+}
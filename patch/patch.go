@@ -0,0 +1,299 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("test operation failed")
+)
+
+func Merge(document map[string]any, patch []byte) (map[string]any, error) {
+	// This function will apply a JSON Merge Patch (RFC 7396) to a copy of the document.
+	// Members set to null are removed, objects are merged recursively and any other value replaces the target.
+	var changes any
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	object, ok := changes.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: a merge patch must be a JSON object", ErrInvalidPatch)
+	}
+	return mergeObject(copyValue(document).(map[string]any), object), nil
+}
+
+func mergeObject(target, changes map[string]any) map[string]any {
+	if target == nil {
+		target = map[string]any{}
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if object, ok := value.(map[string]any); ok {
+			existing, _ := target[key].(map[string]any)
+			target[key] = mergeObject(existing, object)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
+
+// Operation is a single JSON Patch (RFC 6902) operation.
+// Value holds the raw JSON of the value member, it is empty when the member is missing and "null" when it is null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func Apply(document map[string]any, patch []byte) (map[string]any, error) {
+	// This function will apply a JSON Patch (RFC 6902) to a copy of the document.
+	// Operations run in order and the whole patch fails if any of them fails.
+	operations, err := Operations(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var result any = copyValue(document)
+	for i, operation := range operations {
+		result, err = applyOperation(result, operation)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	object, ok := result.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: the patched document must stay a JSON object", ErrInvalidPatch)
+	}
+	return object, nil
+}
+
+func Operations(patch []byte) ([]Operation, error) {
+	// This function will parse a JSON Patch without applying it
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: a JSON patch must be an array of operations", ErrInvalidPatch)
+	}
+	return operations, nil
+}
+
+func applyOperation(document any, operation Operation) (any, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		var value any
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		switch operation.Op {
+		case "add":
+			return add(document, path, value)
+		case "replace":
+			if _, err := get(document, path); err != nil {
+				return nil, err
+			}
+			document, err = remove(document, path)
+			if err != nil {
+				return nil, err
+			}
+			return add(document, path, value)
+		default:
+			current, err := get(document, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return document, nil
+		}
+	case "remove":
+		return remove(document, path)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+			}
+			document, err = remove(document, from)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = copyValue(value)
+		}
+		return add(document, path, value)
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, operation.Op)
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	// JSON Pointers (RFC 6901) start with a slash and escape "~" as "~0" and "/" as "~1"
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with a slash", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(document any, path []string) (any, error) {
+	current := document
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+			}
+			current = value
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot descend into %q", ErrInvalidPatch, token)
+		}
+	}
+	return current, nil
+}
+
+func add(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil // Adding at the root replaces the whole document
+	}
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return document, nil
+	case []any:
+		index := len(node)
+		if last != "-" {
+			index, err = arrayIndex(last, len(node))
+			if err != nil {
+				return nil, err
+			}
+		}
+		node = append(node[:index], append([]any{value}, node[index:]...)...)
+		return set(document, path[:len(path)-1], node)
+	}
+	return nil, fmt.Errorf("%w: cannot add a member to a scalar value", ErrInvalidPatch)
+}
+
+func remove(document any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		if _, ok := node[last]; !ok {
+			return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, last)
+		}
+		delete(node, last)
+		return document, nil
+	case []any:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:index:index], node[index+1:]...)
+		return set(document, path[:len(path)-1], node)
+	}
+	return nil, fmt.Errorf("%w: cannot remove a member of a scalar value", ErrInvalidPatch)
+}
+
+func set(document any, path []string, value any) (any, error) {
+	// Slices change identity when they grow or shrink, so their new value is stored back in the parent
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(document, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+	case []any:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return document, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	return index, nil
+}
+
+func copyValue(value any) any {
+	// Patches work on a deep copy so a failed patch leaves the original document untouched
+	switch node := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(node))
+		for key, item := range node {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(node))
+		for i, item := range node {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,35 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyNullValue(t *testing.T) {
+	// A null value is a value like any other, only a missing one is invalid
+	document := map[string]any{"title": "Go meetup", "description": "Talks"}
+
+	tests := []struct {
+		name  string
+		patch string
+		want  map[string]any
+		err   error
+	}{
+		{"replace with null", `[{"op":"replace","path":"/description","value":null}]`, map[string]any{"title": "Go meetup", "description": nil}, nil},
+		{"add null", `[{"op":"add","path":"/location","value":null}]`, map[string]any{"title": "Go meetup", "description": "Talks", "location": nil}, nil},
+		{"test null", `[{"op":"add","path":"/location","value":null},{"op":"test","path":"/location","value":null}]`, map[string]any{"title": "Go meetup", "description": "Talks", "location": nil}, nil},
+		{"missing value", `[{"op":"replace","path":"/description"}]`, nil, ErrInvalidPatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Apply(document, []byte(test.patch))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Apply() error = %v, want %v", err, test.err)
+			}
+			if test.err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Apply() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
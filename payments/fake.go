@@ -0,0 +1,25 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeRefundProvider is a local provider for tests that records refunds in memory without moving any money.
+type FakeRefundProvider struct {
+	mutex   sync.Mutex
+	Refunds []RefundRequest
+}
+
+func NewFakeRefundProvider() *FakeRefundProvider {
+	return &FakeRefundProvider{}
+}
+
+func (p *FakeRefundProvider) Refund(ctx context.Context, request RefundRequest) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Refunds = append(p.Refunds, request)
+	return fmt.Sprintf("fake_refund_%d", len(p.Refunds)), nil
+}
@@ -0,0 +1,90 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const refundRequestTimeout = 30 * time.Second
+
+// HTTPRefundProvider asks a payment service for refunds over HTTP.
+// Each refund is POSTed as JSON with an Idempotency-Key derived from the refund id,
+// and the service answers with the reference of the refund.
+type HTTPRefundProvider struct {
+	URL    string
+	Token  string // Sent as a bearer token when set
+	Client *http.Client
+}
+
+func ProviderFromEnv() (RefundProvider, error) {
+	// Returns the provider set by REFUND_PROVIDER_URL and REFUND_PROVIDER_TOKEN, nil when no provider is configured
+	address := os.Getenv("REFUND_PROVIDER_URL")
+	if address == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, errors.New("REFUND_PROVIDER_URL must be an http or https URL")
+	}
+	return &HTTPRefundProvider{
+		URL:    address,
+		Token:  os.Getenv("REFUND_PROVIDER_TOKEN"),
+		Client: &http.Client{Timeout: refundRequestTimeout},
+	}, nil
+}
+
+type httpRefundRequest struct {
+	RefundId int64  `json:"refundId"`
+	EventId  int64  `json:"eventId"`
+	UserId   int64  `json:"userId"`
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason"`
+}
+
+type httpRefundResponse struct {
+	Reference string `json:"reference"`
+}
+
+func (p *HTTPRefundProvider) Refund(ctx context.Context, request RefundRequest) (string, error) {
+	body, err := json.Marshal(httpRefundRequest(request))
+	if err != nil {
+		return "", err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Idempotency-Key", "refund-"+strconv.FormatInt(request.RefundId, 10))
+	if p.Token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	response, err := p.Client.Do(httpRequest)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+		return "", fmt.Errorf("refund provider answered %s", response.Status)
+	}
+
+	var refund httpRefundResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<16)).Decode(&refund); err != nil {
+		return "", fmt.Errorf("decoding the refund provider response: %w", err)
+	}
+	if refund.Reference == "" {
+		return "", errors.New("refund provider answered without a reference")
+	}
+	return refund.Reference, nil
+}
@@ -0,0 +1,61 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPRefundProvider(t *testing.T) {
+	var received httpRefundRequest
+	var idempotencyKey, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey, authorization = r.Header.Get("Idempotency-Key"), r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding the refund: %v", err)
+		}
+		if received.Amount < 0 {
+			http.Error(w, "negative amount", http.StatusUnprocessableEntity)
+			return
+		}
+		w.Write([]byte(`{"reference":"re_123"}`))
+	}))
+	t.Cleanup(server.Close)
+	provider := &HTTPRefundProvider{URL: server.URL, Token: "secret", Client: server.Client()}
+	request := RefundRequest{RefundId: 7, EventId: 1, UserId: 2, Amount: 1500, Reason: "cancelled_by_attendee"}
+
+	reference, err := provider.Refund(context.Background(), request)
+	if err != nil || reference != "re_123" {
+		t.Fatalf("Refund = %q, %v, want re_123", reference, err)
+	}
+	if received != httpRefundRequest(request) || idempotencyKey != "refund-7" || authorization != "Bearer secret" {
+		t.Errorf("sent %+v with Idempotency-Key %q and Authorization %q", received, idempotencyKey, authorization)
+	}
+
+	request.Amount = -1
+	if reference, err := provider.Refund(context.Background(), request); err == nil {
+		t.Errorf("Refund = %q, want the rejection reported", reference)
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	tests := []struct {
+		url     string
+		enabled bool
+		valid   bool
+	}{
+		{"", false, true},
+		{"https://payments.internal/refunds", true, true},
+		{"payments.internal/refunds", false, false},
+		{"ftp://payments.internal/refunds", false, false},
+	}
+	for _, test := range tests {
+		t.Setenv("REFUND_PROVIDER_URL", test.url)
+		provider, err := ProviderFromEnv()
+		if (err == nil) != test.valid || (provider != nil) != test.enabled {
+			t.Errorf("ProviderFromEnv with %q = %v, %v", test.url, provider, err)
+		}
+	}
+}
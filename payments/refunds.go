@@ -0,0 +1,32 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoProvider = errors.New("no refund provider is configured")
+
+type RefundRequest struct {
+	RefundId int64 // Stays the same when a refund is retried, providers use it to pay each refund once
+	EventId  int64
+	UserId   int64
+	Amount   int64 // Amount in the smallest currency unit (e.g. cents)
+	Reason   string
+}
+
+// RefundProvider issues refunds against the payment processor that took the original payment.
+type RefundProvider interface {
+	// Refund sends the money back and returns the provider's reference for the refund
+	Refund(ctx context.Context, request RefundRequest) (string, error)
+}
+
+// Provider is the refund provider used by the application, main sets it from the configuration.
+// Until then refunds fail with ErrNoProvider, so they are recorded as failed and retried later.
+var Provider RefundProvider = unconfiguredProvider{}
+
+type unconfiguredProvider struct{}
+
+func (unconfiguredProvider) Refund(ctx context.Context, request RefundRequest) (string, error) {
+	return "", ErrNoProvider
+}
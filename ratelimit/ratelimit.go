@@ -0,0 +1,125 @@
+// Package ratelimit counts requests in token buckets. Every key, e.g. a user or an IP address, has a bucket
+// holding up to Burst tokens that refills at Rate tokens per second, and each request takes one token.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is the size and refill rate of a bucket, the zero Limit does not limit anything
+type Limit struct {
+	Rate  float64 // Tokens added per second
+	Burst int     // Tokens a full bucket holds, the most requests allowed at once
+}
+
+// PerMinute allows requests per minute on average and up to burst of them at once
+func PerMinute(requests, burst int) Limit {
+	return Limit{Rate: float64(requests) / 60, Burst: burst}
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Burst <= 0 || l.Rate <= 0
+}
+
+// Window is how long an empty bucket takes to fill up again
+func (l Limit) Window() time.Duration {
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Result is the state of a bucket after a request tried to take a token from it
+type Result struct {
+	Allowed    bool
+	Remaining  int           // Tokens left in the bucket
+	RetryAfter time.Duration // How long to wait for the next token when the request was not allowed
+	Reset      time.Duration // How long until the bucket is full again
+}
+
+// Store keeps the buckets. MemoryStore serves a single instance; deployments running several instances share
+// the buckets through a Store backed by e.g. Redis, which must take the token atomically for each call.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+// MemoryStore keeps the buckets in memory, it is safe for concurrent use
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute // How often buckets that are full again are dropped
+
+// MemoryStoreOption changes how a MemoryStore is set up
+type MemoryStoreOption func(*MemoryStore)
+
+// WithClock makes the store read the time from now instead of the system clock, so tests control the refill
+func WithClock(now func() time.Time) MemoryStoreOption {
+	return func(s *MemoryStore) { s.now = now }
+}
+
+func NewMemoryStore(options ...MemoryStoreOption) *MemoryStore {
+	store := &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+	for _, option := range options {
+		option(store)
+	}
+	return store
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	current, ok := s.buckets[key]
+	if !ok {
+		current = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = current
+	}
+	current.limit = limit
+	current.refill(now)
+
+	result := Result{Allowed: current.tokens >= 1}
+	if result.Allowed {
+		current.tokens--
+	} else {
+		result.RetryAfter = seconds((1 - current.tokens) / limit.Rate)
+	}
+	result.Remaining = int(current.tokens)
+	result.Reset = seconds((float64(limit.Burst) - current.tokens) / limit.Rate)
+	return result, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	// A bucket that had time to fill up behaves exactly like a missing one, so it can be dropped
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, current := range s.buckets {
+		current.refill(now)
+		if current.tokens >= float64(current.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store whose clock only moves when the returned function is called
+func newTestStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(WithClock(func() time.Time { return now }))
+	return store, func(duration time.Duration) { now = now.Add(duration) }
+}
+
+func take(t *testing.T, store *MemoryStore, key string, limit Limit) Result {
+	t.Helper()
+	result, err := store.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take(%q): %v", key, err)
+	}
+	return result
+}
+
+func TestMemoryStoreBurstAndRefill(t *testing.T) {
+	store, advance := newTestStore()
+	limit := PerMinute(15, 3) // A token every 4 seconds
+
+	for want := 2; want >= 0; want-- {
+		result := take(t, store, "user:1", limit)
+		if !result.Allowed || result.Remaining != want {
+			t.Fatalf("got %+v, want an allowed request with %d remaining", result, want)
+		}
+	}
+
+	result := take(t, store, "user:1", limit)
+	if result.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if result.RetryAfter != 4*time.Second {
+		t.Errorf("RetryAfter = %v, want 4s", result.RetryAfter)
+	}
+	if result.Reset != 12*time.Second {
+		t.Errorf("Reset = %v, want 12s", result.Reset)
+	}
+
+	if result := take(t, store, "user:2", limit); !result.Allowed {
+		t.Error("another key shares the empty bucket")
+	}
+
+	advance(time.Second)
+	if result := take(t, store, "user:1", limit); result.Allowed || result.RetryAfter != 3*time.Second {
+		t.Errorf("got %+v, want a refused request retrying after 3s", result)
+	}
+
+	advance(3 * time.Second)
+	if result := take(t, store, "user:1", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v, want the refilled token to be allowed", result)
+	}
+
+	advance(time.Hour)
+	if result := take(t, store, "user:1", limit); result.Remaining != 2 {
+		t.Errorf("Remaining = %d after a long pause, want the bucket to stop at its burst", result.Remaining)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store, advance := newTestStore()
+	loose := PerMinute(60, 1)
+	strict := Limit{Rate: 1.0 / 120, Burst: 1}
+
+	take(t, store, "loose", loose)
+	take(t, store, "strict", strict)
+
+	// The loose bucket is full again after a second, the strict one needs two minutes
+	advance(sweepInterval)
+	take(t, store, "other", loose)
+	if len(store.buckets) != 2 {
+		t.Fatalf("%d buckets after the sweep, want the strict and the new one", len(store.buckets))
+	}
+	if _, ok := store.buckets["strict"]; !ok {
+		t.Fatal("the strict bucket was dropped before it refilled")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	if !(Limit{}).Unlimited() {
+		t.Error("the zero Limit limits requests")
+	}
+	if PerMinute(60, 10).Unlimited() {
+		t.Error("PerMinute(60, 10) is unlimited")
+	}
+	if window := PerMinute(60, 10).Window(); window != 10*time.Second {
+		t.Errorf("Window = %v, want 10s", window)
+	}
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/calendar"
+	"github.com/ftilie/go-booking-api/middlewares"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+func getEventCalendar(context *gin.Context) {
+	// This function will handle exporting a single event as an iCalendar file
+	event, err := requestedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	context.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, event.Id))
+	context.Data(http.StatusOK, calendarContentType, []byte(calendar.Encode(event.Title, []models.Event{*event})))
+}
+
+func resetCalendarFeed(context *gin.Context) {
+	// This function will handle issuing a new secret calendar feed URL for the user
+	user := models.User{Id: context.GetInt64("userId")}
+	token, err := user.ResetCalendarToken(context.Request.Context())
+	if err != nil {
+		context.Error(wrapError(err, "Failed to create calendar feed"))
+		return
+	}
+
+	// Feeds are long lived, so the URL points at the current version even when a deprecated one was called
+	prefix := ""
+	if version := middlewares.RequestAPIVersion(context); version != nil {
+		prefix = version.Current().Prefix
+	}
+	url := fmt.Sprintf("%s://%s%s/calendar/%s/events.ics", middlewares.RequestScheme(context), context.Request.Host, prefix, token)
+
+	context.JSON(http.StatusCreated, gin.H{"message": "Calendar feed created successfully! Previous feed URLs no longer work.", "url": url})
+}
+
+func getCalendarFeed(context *gin.Context) {
+	// This function will handle serving the personal calendar feed, the secret token in the URL authenticates the user
+	userId, err := models.GetUserIdByCalendarToken(context.Request.Context(), context.Param("token"))
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve calendar feed"))
+		return
+	}
+
+	events, err := models.GetCalendarEvents(context.Request.Context(), userId)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve events from the database"))
+		return
+	}
+
+	context.Data(http.StatusOK, calendarContentType, []byte(calendar.Encode("My events", events)))
+}
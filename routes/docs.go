@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+func getOpenAPI(context *gin.Context) {
+	// This function will handle serving the OpenAPI document of the API
+	context.Data(http.StatusOK, "application/json", openapi.Spec)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers attach their errors with context.Error and return,
+// middlewares.Errors renders them as problem details
+
+func wrapError(err error, message string) error {
+	// Domain errors are passed through, anything else is an internal error described by message
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return apperrors.Internal(message, err)
+}
+
+func routeNotFound(context *gin.Context) {
+	// This function will handle requests that do not match any route
+	context.Error(apperrors.NotFound("route_not_found", "No route matches "+context.Request.Method+" "+context.Request.URL.Path))
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+var errIfMatchRequired = apperrors.New(apperrors.ErrPreconditionRequired, "if_match_required", "Send the event's ETag in an If-Match header to change it")
+
+func eventETag(event *models.Event) string {
+	// The ETag of an event is its version, every change to the event or its attendees bumps it
+	return `"` + strconv.FormatInt(event.Version, 10) + `"`
+}
+
+func setEventETag(context *gin.Context, event *models.Event) {
+	context.Header("ETag", eventETag(event))
+}
+
+func checkIfMatch(context *gin.Context, event *models.Event) error {
+	// Changes must name the version they were based on so concurrent edits do not overwrite each other
+	header := context.GetHeader("If-Match")
+	if header == "" {
+		return errIfMatchRequired
+	}
+	if !matchesETag(header, eventETag(event), false) {
+		return models.ErrVersionMismatch
+	}
+	return nil
+}
+
+func notModified(context *gin.Context, event *models.Event) bool {
+	// Reads answer 304 without a body when the client already holds the current version
+	header := context.GetHeader("If-None-Match")
+	if header == "" || !matchesETag(header, eventETag(event), true) {
+		return false
+	}
+	setEventETag(context, event)
+	context.Status(http.StatusNotModified)
+	return true
+}
+
+func matchesETag(header, etag string, weak bool) bool {
+	// The header holds "*" or a comma separated list of entity tags.
+	// If-Match uses the strong comparison, weak tags never match it (RFC 9110, section 13.1.1).
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,207 +1,325 @@
 package routes
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
 	"net/http"
 	"reflect"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/metrics"
 	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/patch"
+	"github.com/ftilie/go-booking-api/validation"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+const maxPatchSize = 1 << 20 // 1 MiB
+
 func getEvents(context *gin.Context) {
 	// This function will handle retrieving all events
-	events, err := models.GetEvents()
+	events, err := models.GetEvents(context.Request.Context())
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve events from the database!"})
+		context.Error(wrapError(err, "Failed to retrieve events from the database"))
 		return
 	}
-	context.JSON(http.StatusOK, events)
+	context.JSON(http.StatusOK, present(context, events))
 }
 
 func getEvent(context *gin.Context) {
-	// This function will handle retrieving a specific event by its ID``
-	stringEventId := context.Param("eventId")
-	if stringEventId == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Event ID is required!"})
-		return
-	}
-	eventId, err := strconv.ParseInt(stringEventId, 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Failed to parse event Id!"})
-		return
-	}
-
-	event, err := models.GetEvent(eventId)
+	// This function will handle retrieving a specific event by its ID
+	event, err := requestedEvent(context)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event from the database!"})
+		context.Error(err)
 		return
 	}
-	if event == nil {
-		context.JSON(http.StatusNotFound, gin.H{"message": "Event not found!"})
+	if notModified(context, event) {
 		return
 	}
 
-	context.JSON(http.StatusOK, event)
+	setEventETag(context, event)
+	context.JSON(http.StatusOK, present(context, event))
 }
 
 func createEvent(context *gin.Context) {
 	// This function will handle creating a new event
-	var event models.Event
-	err := context.ShouldBindJSON(&event)
+	var request dto.NewEvent
+	err := context.ShouldBindJSON(&request)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input could not be parsed!"})
+		context.Error(validation.Error(err))
+		return
+	}
+	event := request.Model()
+	if err := validation.Validate(&event); err != nil {
+		context.Error(err)
 		return
 	}
 
 	event.Organizer = context.GetInt64("userId") // Get the user ID from the context set by the authentication middleware
 	event.CreatedAt = time.Now()
 
-	err = event.CreateEvent()
+	err = event.CreateEvent(context.Request.Context())
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create event in the database!"})
+		context.Error(wrapError(err, "Failed to create event in the database"))
 		return
 	}
 
-	context.JSON(http.StatusCreated, gin.H{"message": "Event created successfully!", "event": event})
+	metrics.EventsCreated.Inc()
+	setEventETag(context, &event)
+	context.JSON(http.StatusCreated, gin.H{"message": "Event created successfully!", "event": present(context, &event)})
 }
 
 func updateEvent(context *gin.Context) {
-	// This function will handle updating an existing event
-	stringEventId := context.Param("eventId")
-	if stringEventId == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Event ID is required!"})
+	// This function will handle patching an existing event.
+	// The body is a JSON Merge Patch (RFC 7396), or a JSON Patch (RFC 6902) when sent as application/json-patch+json.
+	// Only the fields of models.EventChanges can be changed and the patched event is validated again.
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
 		return
 	}
-	eventId, err := strconv.ParseInt(stringEventId, 10, 64)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Failed to parse event Id!"})
+	if err := checkIfMatch(context, event); err != nil {
+		context.Error(err)
+		return
+	}
+
+	if event.EndTime.Before(time.Now()) {
+		context.Error(models.ErrEventEnded)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(context.Writer, context.Request.Body, maxPatchSize))
+	if tooLarge(err) {
+		context.Error(apperrors.New(apperrors.ErrPayloadTooLarge, "patch_too_large", "Patches must not exceed 1 MiB"))
 		return
 	}
-	event, err := models.GetEvent(eventId)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event from the database!"})
+		context.Error(apperrors.BadRequest("unreadable_body", "Failed to read the request body"))
 		return
 	}
 
-	if event.EndTime.Before(time.Now()) {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Cannot update an event that has already ended!"})
-		return
-	}
-
-	if event.DeletedAt != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Cannot update an event that was deleted!"})
-		return
-	}
-
-	if context.GetInt64("userId") != event.Organizer {
-		context.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to update this event!"})
-		return
-	}
-
-	// Support for partial patching
-	var input map[string]interface{}
-	if err := context.BindJSON(&input); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON!"})
-		return
-	}
-	eventValue := reflect.ValueOf(event).Elem()
-	eventType := reflect.TypeOf(event).Elem()
-
-	for key, val := range input {
-		for i := 0; i < eventType.NumField(); i++ {
-			field := eventType.Field(i)
-			fieldName := field.Name
-
-			// Match field names case-insensitively
-			if strings.EqualFold(fieldName, key) {
-				fieldValue := eventValue.FieldByName(fieldName)
-				if !fieldValue.CanSet() {
-					continue
-				}
-
-				// Type conversion depending on the field type
-				switch fieldValue.Kind() {
-				case reflect.String:
-					if str, ok := val.(string); ok {
-						fieldValue.SetString(str)
-					}
-				case reflect.Int64:
-					if f, ok := val.(float64); ok { // JSON numbers are float64
-						fieldValue.SetInt(int64(f))
-					}
-				case reflect.Slice:
-					if s, ok := val.([]interface{}); ok {
-						var slice []int64
-						for _, item := range s {
-							if num, ok := item.(float64); ok {
-								slice = append(slice, int64(num))
-							}
-						}
-						fieldValue.Set(reflect.ValueOf(slice))
-					}
-				case reflect.Struct:
-					if field.Type == reflect.TypeOf(time.Time{}) {
-						if str, ok := val.(string); ok {
-							if parsed, err := time.Parse(time.RFC3339, str); err == nil {
-								fieldValue.Set(reflect.ValueOf(parsed))
-							}
-						}
-					}
-				}
-			}
-		}
+	changes, err := patchEvent(event, context.ContentType(), body)
+	if err != nil {
+		context.Error(err)
+		return
 	}
 
+	event.ApplyChanges(changes)
 	now := time.Now()
 	event.UpdatedAt = &now
 
-	if err := event.UpdateEvent(); err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update event", "error": err.Error()})
+	if err := event.UpdateEvent(context.Request.Context()); err != nil {
+		context.Error(wrapError(err, "Failed to update event in the database"))
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Event updated successfully!", "event": event})
+	setEventETag(context, event)
+	context.JSON(http.StatusOK, gin.H{"message": "Event updated successfully!", "event": present(context, event)})
 }
 
-func deleteEvent(context *gin.Context) {
-	// This function will handle deleting an event
-	stringEventId := context.Param("eventId")
-	if stringEventId == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Event ID is required!"})
-		return
+func patchEvent(event *models.Event, contentType string, body []byte) (models.EventChanges, error) {
+	// Applies the patch to the mutable fields of the event and validates the result, the event itself is left untouched
+	document, err := eventDocument(event.Changes())
+	if err != nil {
+		return models.EventChanges{}, apperrors.Internal("Failed to prepare the event for patching", err)
+	}
+	body, fields := canonicalPatch(contentType, body)
+	if len(fields) > 0 {
+		return models.EventChanges{}, apperrors.Validation("Some fields are invalid", fields...)
+	}
+
+	switch contentType {
+	case patch.MergePatchContentType, "application/json", "":
+		document, err = patch.Merge(document, body)
+	case patch.JSONPatchContentType:
+		document, err = patch.Apply(document, body)
+	default:
+		return models.EventChanges{}, apperrors.New(apperrors.ErrUnsupportedMediaType, "unsupported_patch_format",
+			"Patches must be sent as "+patch.MergePatchContentType+" or "+patch.JSONPatchContentType)
+	}
+	if errors.Is(err, patch.ErrTestFailed) {
+		return models.EventChanges{}, apperrors.Conflict("patch_test_failed", err.Error())
 	}
-	eventId, err := strconv.ParseInt(stringEventId, 10, 64)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Failed to parse event Id!"})
-		return
+		return models.EventChanges{}, apperrors.BadRequest("invalid_patch", err.Error())
 	}
 
-	event, err := models.GetEvent(eventId)
+	changes, fields := decodeEventChanges(document)
+	if len(fields) == 0 {
+		if err := binding.Validator.ValidateStruct(&changes); err != nil {
+			fields = validation.Fields(err)
+		}
+		// Events already under way keep their start time, a new start time must be in the future
+		if !changes.StartTime.Equal(event.StartTime) && !changes.StartTime.After(time.Now()) {
+			fields = append(fields, apperrors.FieldError{Field: "startTime", Rule: "future", Message: "Must be in the future"})
+		}
+	}
+	if len(fields) > 0 {
+		return models.EventChanges{}, apperrors.Validation("Some fields are invalid", fields...)
+	}
+	return changes, nil
+}
+
+func eventDocument(changes models.EventChanges) (map[string]any, error) {
+	// The mutable fields as a generic JSON object, the form patches are applied to
+	encoded, err := json.Marshal(changes)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event from the database!"})
-		return
+		return nil, err
 	}
-	if event == nil {
-		context.JSON(http.StatusNotFound, gin.H{"message": "Event not found!"})
-		return
+	var document map[string]any
+	err = json.Unmarshal(encoded, &document)
+	return document, err
+}
+
+// eventMembers maps the members of models.EventChanges in lower case to their canonical name
+var eventMembers = func() map[string]string {
+	members := map[string]string{}
+	changes := reflect.TypeFor[models.EventChanges]()
+	for i := range changes.NumField() {
+		name, _, _ := strings.Cut(changes.Field(i).Tag.Get("json"), ",")
+		members[strings.ToLower(name)] = name
+	}
+	return members
+}()
+
+func canonicalMember(member string) string {
+	// Members are matched without regard to case like encoding/json does, existing clients send them in PascalCase
+	if canonical, ok := eventMembers[strings.ToLower(member)]; ok {
+		return canonical
+	}
+	return member
+}
+
+func canonicalPatch(contentType string, body []byte) ([]byte, []apperrors.FieldError) {
+	// Renames the members the patch changes to their canonical name, otherwise they would be applied next to the
+	// canonical members of the event and lose to them once decoded. A body that cannot be read is returned as is,
+	// applying it reports why.
+	switch contentType {
+	case patch.MergePatchContentType, "application/json", "":
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(body, &members); err != nil {
+			return body, nil
+		}
+		canonical := make(map[string]json.RawMessage, len(members))
+		var fields []apperrors.FieldError
+		for _, member := range slices.Sorted(maps.Keys(members)) {
+			name := canonicalMember(member)
+			if _, ok := canonical[name]; ok {
+				fields = append(fields, apperrors.FieldError{Field: name, Rule: "duplicate", Message: "Is set more than once"})
+				continue
+			}
+			canonical[name] = members[member]
+		}
+		if len(fields) > 0 {
+			return nil, fields
+		}
+		encoded, err := json.Marshal(canonical)
+		if err != nil {
+			return body, nil
+		}
+		return encoded, nil
+	case patch.JSONPatchContentType:
+		operations, err := patch.Operations(body)
+		if err != nil {
+			return body, nil
+		}
+		for i := range operations {
+			operations[i].Path = canonicalPointer(operations[i].Path)
+			operations[i].From = canonicalPointer(operations[i].From)
+		}
+		encoded, err := json.Marshal(operations)
+		if err != nil {
+			return body, nil
+		}
+		return encoded, nil
 	}
+	return body, nil
+}
 
-	if context.GetInt64("userId") != event.Organizer {
-		context.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to delete this event!"})
+func canonicalPointer(pointer string) string {
+	// Only the first token names a member of the event, the canonical names need no escaping
+	if !strings.HasPrefix(pointer, "/") {
+		return pointer
+	}
+	member, rest, nested := strings.Cut(pointer[1:], "/")
+	if nested {
+		return "/" + canonicalMember(member) + "/" + rest
+	}
+	return "/" + canonicalMember(member)
+}
+
+func decodeEventChanges(document map[string]any) (models.EventChanges, []apperrors.FieldError) {
+	// Members are decoded one at a time so every member outside the allow-list or of the wrong type is reported
+	var changes models.EventChanges
+	var fields []apperrors.FieldError
+	for _, member := range slices.Sorted(maps.Keys(document)) {
+		encoded, err := json.Marshal(map[string]any{member: document[member]})
+		if err != nil {
+			fields = append(fields, apperrors.FieldError{Field: member, Rule: "type", Message: "Could not be read"})
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&changes)
+		switch {
+		case err == nil:
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			fields = append(fields, apperrors.FieldError{Field: member, Rule: "immutable", Message: "Cannot be changed"})
+		default:
+			fields = append(fields, apperrors.FieldError{Field: member, Rule: "type", Message: typeMessage(err)})
+		}
+	}
+	return changes, fields
+}
+
+func typeMessage(err error) string {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		switch typeError.Type.Kind() {
+		case reflect.String:
+			return "Must be a string"
+		case reflect.Int64:
+			return "Must be an integer"
+		}
+	}
+	return "Must be an RFC 3339 timestamp" // Only the time fields have their own decoding
+}
+
+func deleteEvent(context *gin.Context) {
+	// This function will handle deleting an event
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+	if err := checkIfMatch(context, event); err != nil {
+		context.Error(err)
 		return
 	}
 
 	now := time.Now()
 	event.DeletedAt = &now // Set DeletedAt to current time
-	err = event.DeleteEvent()
+	err = event.DeleteEvent(context.Request.Context())
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete event from the database!"})
+		context.Error(wrapError(err, "Failed to delete event from the database"))
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully!", "event": event})
-}
+	// Cancelling the event refunds every attendee who paid for a ticket.
+	// Failed refunds are recorded with a failed status and retried in the background, they do not fail the request.
+	refunds, err := event.RefundAttendees(context.Request.Context())
+	if err != nil {
+		logger.FromContext(context).Warn("some refunds failed after deleting event", "error", err)
+	}
 
+	context.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully!", "event": present(context, event), "refunds": present(context, refunds)})
+}
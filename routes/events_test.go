@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/patch"
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin/binding"
+)
+
+var patchContentTypes = []string{patch.MergePatchContentType, patch.JSONPatchContentType, "application/json", "", "text/plain"}
+
+func patchableEvent() *models.Event {
+	start := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	return &models.Event{
+		Id:        1,
+		Title:     "Go meetup",
+		Location:  "Cluj",
+		StartTime: start,
+		EndTime:   start.Add(2 * time.Hour),
+		Organizer: 1,
+		Price:     1500,
+		Version:   1,
+	}
+}
+
+func TestPatchEvent(t *testing.T) {
+	validation.Register()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		kind        error
+		code        string
+	}{
+		{"merge patch", patch.MergePatchContentType, `{"title":"Renamed","price":0}`, nil, ""},
+		{"json patch", patch.JSONPatchContentType, `[{"op":"test","path":"/title","value":"Go meetup"},{"op":"replace","path":"/title","value":"Renamed"}]`, nil, ""},
+		{"empty merge patch", patch.MergePatchContentType, `{}`, nil, ""},
+		{"unsupported format", "text/plain", `{}`, apperrors.ErrUnsupportedMediaType, "unsupported_patch_format"},
+		{"malformed json", patch.MergePatchContentType, `{"title":`, apperrors.ErrBadRequest, "invalid_patch"},
+		{"failed test", patch.JSONPatchContentType, `[{"op":"test","path":"/title","value":"Other"}]`, apperrors.ErrConflict, "patch_test_failed"},
+		{"remove required field", patch.JSONPatchContentType, `[{"op":"remove","path":"/title"}]`, apperrors.ErrValidation, "validation_failed"},
+		{"null title", patch.MergePatchContentType, `{"title":null}`, apperrors.ErrValidation, "validation_failed"},
+		{"immutable field", patch.MergePatchContentType, `{"organizer":2}`, apperrors.ErrValidation, "validation_failed"},
+		{"end before start", patch.MergePatchContentType, `{"endTime":"2000-01-01T00:00:00Z"}`, apperrors.ErrValidation, "validation_failed"},
+		{"start in the past", patch.MergePatchContentType, `{"startTime":"2000-01-01T00:00:00Z"}`, apperrors.ErrValidation, "validation_failed"},
+		{"pascal case merge patch", "application/json", `{"Title":"Renamed","Location":"Bucharest"}`, nil, ""},
+		{"pascal case json patch", patch.JSONPatchContentType, `[{"op":"replace","path":"/Title","value":"Renamed"}]`, nil, ""},
+		{"member set twice", patch.MergePatchContentType, `{"Title":"Renamed","title":"Other"}`, apperrors.ErrValidation, "validation_failed"},
+		{"patch is not an object", patch.MergePatchContentType, `"title"`, apperrors.ErrBadRequest, "invalid_patch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := patchableEvent()
+			changes, err := patchEvent(event, test.contentType, []byte(test.body))
+			if test.kind == nil {
+				if err != nil {
+					t.Fatalf("patchEvent() error = %v", err)
+				}
+				if event.Title != "Go meetup" {
+					t.Fatalf("patchEvent() changed the event itself")
+				}
+				if strings.Contains(test.body, "Renamed") && changes.Title != "Renamed" {
+					t.Fatalf("patchEvent() = %+v, want the title renamed", changes)
+				}
+				if changes.EndTime.Before(changes.StartTime) {
+					t.Fatalf("patchEvent() = %+v, ends before it starts", changes)
+				}
+				return
+			}
+			var apiError *apperrors.Error
+			if !errors.As(err, &apiError) || !errors.Is(err, test.kind) || apiError.Code != test.code {
+				t.Fatalf("patchEvent() error = %v, want %v %q", err, test.kind, test.code)
+			}
+		})
+	}
+}
+
+func FuzzPatchEvent(f *testing.F) {
+	// Any patch is either applied, leaving a valid event, or rejected as a client error
+	validation.Register()
+	f.Add(uint8(0), []byte(`{"title":"Renamed","description":null}`))
+	f.Add(uint8(0), []byte(`{"startTime":"2999-01-01T10:00:00Z","endTime":"2999-01-01T12:00:00Z"}`))
+	f.Add(uint8(0), []byte(`{"Title":"Case","TITLE":null}`))
+	f.Add(uint8(0), []byte(`{"price":1e400}`))
+	f.Add(uint8(0), []byte(`{"organizer":2,"attendees":[3]}`))
+	f.Add(uint8(1), []byte(`[{"op":"move","from":"/title","path":"/location"}]`))
+	f.Add(uint8(1), []byte(`[{"op":"copy","from":"/startTime","path":"/endTime"}]`))
+	f.Add(uint8(1), []byte(`[{"op":"add","path":"/-","value":1}]`))
+	f.Add(uint8(2), []byte(`null`))
+	f.Add(uint8(4), []byte(`{}`))
+
+	f.Fuzz(func(t *testing.T, format uint8, body []byte) {
+		event := patchableEvent()
+		original := *event
+		contentType := patchContentTypes[int(format)%len(patchContentTypes)]
+		changes, err := patchEvent(event, contentType, body)
+		if err != nil {
+			var apiError *apperrors.Error
+			if !errors.As(err, &apiError) || errors.Is(err, apperrors.ErrInternal) {
+				t.Fatalf("patchEvent(%q) failed with a server error: %v", body, err)
+			}
+			return
+		}
+
+		if err := binding.Validator.ValidateStruct(&changes); err != nil {
+			t.Fatalf("patchEvent(%q) returned invalid changes: %v", body, err)
+		}
+		if !changes.EndTime.After(changes.StartTime) {
+			t.Fatalf("patchEvent(%q) returned an event ending before it starts: %+v", body, changes)
+		}
+		if !reflect.DeepEqual(*event, original) {
+			t.Fatalf("patchEvent(%q) changed the event itself", body)
+		}
+
+		// Merge patches are idempotent, applying the same one again changes nothing more
+		if contentType == patch.JSONPatchContentType {
+			return
+		}
+		event.ApplyChanges(changes)
+		again, err := patchEvent(event, contentType, body)
+		if err != nil {
+			t.Fatalf("patchEvent(%q) failed when applied a second time: %v", body, err)
+		}
+		if again.Title != changes.Title || again.Description != changes.Description || again.Location != changes.Location ||
+			again.Price != changes.Price || !again.StartTime.Equal(changes.StartTime) || !again.EndTime.Equal(changes.EndTime) {
+			t.Fatalf("patchEvent(%q) is not idempotent: %+v then %+v", body, changes, again)
+		}
+	})
+}
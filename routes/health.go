@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/buildinfo"
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/gin-gonic/gin"
+)
+
+func getHealth(context *gin.Context) {
+	// This function will handle the liveness probe, answering means the process is alive
+	context.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func getReadiness(context *gin.Context) {
+	// This function will handle the readiness probe, traffic should only be routed when every check passes
+	results, ready := health.Run(context.Request.Context())
+	if !ready {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": results})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"status": "ok", "checks": results})
+}
+
+func getVersion(context *gin.Context) {
+	// This function will handle reporting the build information of the running binary
+	context.JSON(http.StatusOK, buildinfo.Get())
+}
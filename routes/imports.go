@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/importer"
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const maxImportSize = 10 << 20 // 10 MiB
+
+var errImportTooLarge = apperrors.New(apperrors.ErrPayloadTooLarge, "import_file_too_large", "Import file must not exceed 10 MiB")
+
+type importRowResult struct {
+	Row    int
+	Event  models.Event
+	Errors []string `json:",omitempty"`
+}
+
+func importEvents(context *gin.Context) {
+	// This function will handle creating many events at once from a CSV or iCalendar file.
+	// The file is sent as the "file" field of a multipart form or as the raw request body.
+	// With dryRun=true nothing is created and every row is reported with its errors.
+	dryRun := context.Query("dryRun") == "true"
+
+	var mapping map[string]string
+	if rawMapping := context.Query("mapping"); rawMapping != "" {
+		if err := json.Unmarshal([]byte(rawMapping), &mapping); err != nil {
+			context.Error(apperrors.BadRequest("invalid_mapping", "Mapping must be a JSON object of field names to CSV headers"))
+			return
+		}
+	}
+
+	context.Request.Body = http.MaxBytesReader(context.Writer, context.Request.Body, maxImportSize)
+	file, format, err := importFile(context)
+	if tooLarge(err) {
+		context.Error(errImportTooLarge)
+		return
+	}
+	if err != nil {
+		context.Error(apperrors.BadRequest("unreadable_import_file", "Failed to read the import file"))
+		return
+	}
+	defer file.Close()
+
+	var rows []importer.Row
+	switch format {
+	case "csv":
+		rows, err = importer.ReadCSV(file, mapping)
+	case "ics":
+		rows, err = importer.ReadICS(file)
+	default:
+		context.Error(apperrors.New(apperrors.ErrUnsupportedMediaType, "unsupported_import_format", "Import file must be a CSV or iCalendar file"))
+		return
+	}
+	if tooLarge(err) {
+		context.Error(errImportTooLarge)
+		return
+	}
+	if err != nil {
+		context.Error(apperrors.BadRequest("invalid_import_file", fmt.Sprintf("Failed to parse the import file: %s", err.Error())))
+		return
+	}
+	if len(rows) == 0 {
+		context.Error(apperrors.BadRequest("empty_import_file", "Import file does not contain any event"))
+		return
+	}
+
+	// Every row goes through the same validation as createEvent
+	organizer := context.GetInt64("userId")
+	now := time.Now()
+	results := make([]importRowResult, 0, len(rows))
+	events := make([]models.Event, 0, len(rows))
+	failed := false
+	for _, row := range rows {
+		row.Event.Organizer = organizer
+		row.Event.CreatedAt = now
+		rowErrors := row.Errors
+		if err := binding.Validator.ValidateStruct(&row.Event); err != nil {
+			rowErrors = append(rowErrors, validationMessages(err)...)
+		}
+		if len(rowErrors) > 0 {
+			failed = true
+		}
+		results = append(results, importRowResult{Row: row.Number, Event: row.Event, Errors: rowErrors})
+		events = append(events, row.Event)
+	}
+
+	if dryRun {
+		context.JSON(http.StatusOK, gin.H{"message": "Dry run completed, no event was created.", "valid": !failed, "rows": present(context, results)})
+		return
+	}
+	if failed {
+		context.Error(apperrors.Validation("Some rows are invalid, no event was created").With("rows", present(context, results)))
+		return
+	}
+
+	err = models.CreateEvents(context.Request.Context(), events)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to create events in the database"))
+		return
+	}
+
+	metrics.EventsCreated.Add(float64(len(events)))
+	context.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("%d events imported successfully!", len(events)), "events": present(context, events)})
+}
+
+func importFile(context *gin.Context) (io.ReadCloser, string, error) {
+	// The format is taken from the format query parameter, then the content type of the file,
+	// then the extension of its name when it is sent as a multipart form
+	format := strings.ToLower(context.Query("format"))
+
+	if strings.HasPrefix(context.ContentType(), "multipart/form-data") {
+		header, err := context.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		if format == "" {
+			format = formatFromContentType(header.Header.Get("Content-Type"))
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		return file, format, nil
+	}
+
+	if format == "" {
+		format = formatFromContentType(context.ContentType())
+	}
+	return context.Request.Body, format, nil
+}
+
+func formatFromContentType(contentType string) string {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return "csv"
+	case "text/calendar":
+		return "ics"
+	}
+	return ""
+}
+
+func tooLarge(err error) bool {
+	// Bodies are read through http.MaxBytesReader, which fails once they exceed their limit
+	var maxBytesError *http.MaxBytesError
+	return errors.As(err, &maxBytesError)
+}
+
+func validationMessages(err error) []string {
+	fields := validation.Fields(err)
+	if len(fields) == 0 {
+		return []string{err.Error()}
+	}
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return messages
+}
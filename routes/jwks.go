@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Services verifying our tokens may cache the keys this long, new keys are published well before they sign
+const jwksMaxAge = "public, max-age=900"
+
+func getJWKS(context *gin.Context) {
+	// This function will handle publishing the public keys tokens are verified with
+	context.Header("Cache-Control", jwksMaxAge)
+	context.JSON(http.StatusOK, utils.NewJSONWebKeySet(utils.Keys.PublishedKeys()))
+}
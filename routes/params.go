@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+func eventIdParam(context *gin.Context) (int64, error) {
+	eventId, err := strconv.ParseInt(context.Param("eventId"), 10, 64)
+	if err != nil {
+		return 0, apperrors.BadRequest("invalid_event_id", "Event ID must be a number")
+	}
+	return eventId, nil
+}
+
+func requestedEvent(context *gin.Context) (*models.Event, error) {
+	// Loads the event named by the eventId path parameter
+	eventId, err := eventIdParam(context)
+	if err != nil {
+		return nil, err
+	}
+	event, err := models.GetEvent(context.Request.Context(), eventId)
+	if err != nil {
+		return nil, wrapError(err, "Failed to retrieve event from the database")
+	}
+	return event, nil
+}
+
+func organizedEvent(context *gin.Context) (*models.Event, error) {
+	// Loads the requested event and makes sure the authenticated user organizes it
+	event, err := requestedEvent(context)
+	if err != nil {
+		return nil, err
+	}
+	if err := event.AuthorizeOrganizer(context.GetInt64("userId")); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
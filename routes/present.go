@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/middlewares"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/gin-gonic/gin"
+)
+
+func present(context *gin.Context, value any) any {
+	// Returns the value in the wire format of the API version of the request.
+	// v1 and the unversioned routes keep serializing the models as they always did, later versions use the DTOs.
+	version := middlewares.RequestAPIVersion(context)
+	if version == nil || version == V1 || version == Legacy {
+		return value
+	}
+
+	switch value := value.(type) {
+	case *models.Event:
+		return dto.FromEvent(*value)
+	case []models.Event:
+		return dto.FromEvents(value)
+	case *models.Registration:
+		if value == nil {
+			return nil
+		}
+		return dto.FromRegistration(*value)
+	case *models.Refund:
+		if value == nil {
+			return nil
+		}
+		return dto.FromRefund(*value)
+	case []models.Refund:
+		return dto.FromRefunds(value)
+	case models.TicketType:
+		return dto.FromTicketType(value)
+	case []models.TicketType:
+		return dto.FromTicketTypes(value)
+	case models.DiscountCode:
+		return dto.FromDiscountCode(value)
+	case []models.DiscountCode:
+		return dto.FromDiscountCodes(value)
+	case []importRowResult:
+		rows := make([]dto.ImportRow, 0, len(value))
+		for _, row := range value {
+			rows = append(rows, dto.ImportRow{Row: row.Row, Event: dto.FromEvent(row.Event), Errors: row.Errors})
+		}
+		return rows
+	}
+	return value
+}
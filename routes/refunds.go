@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func updateCancellationPolicy(context *gin.Context) {
+	// This function will handle setting the cancellation policy of an event.
+	// The policy is part of the event, so like other changes it needs the event's ETag in If-Match.
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+	if err := checkIfMatch(context, event); err != nil {
+		context.Error(err)
+		return
+	}
+
+	var request dto.CancellationPolicy
+	err = context.ShouldBindJSON(&request)
+	if err != nil {
+		context.Error(validation.Error(err))
+		return
+	}
+	policy := request.Model()
+	if err := validation.Validate(&policy); err != nil {
+		context.Error(err)
+		return
+	}
+
+	err = event.SaveCancellationPolicy(context.Request.Context(), policy)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to save cancellation policy in the database"))
+		return
+	}
+
+	setEventETag(context, event)
+	context.JSON(http.StatusOK, gin.H{"message": "Cancellation policy updated successfully!", "event": present(context, event)})
+}
+
+func getRefunds(context *gin.Context) {
+	// This function will handle listing the refunds issued for an event
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	refunds, err := models.GetRefunds(context.Request.Context(), event.Id)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve refunds from the database"))
+		return
+	}
+
+	context.JSON(http.StatusOK, present(context, refunds))
+}
@@ -1,67 +1,144 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
 
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/metrics"
 	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/utils"
+	"github.com/ftilie/go-booking-api/validation"
 	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
 )
 
 func registerForEvent(context *gin.Context) {
 	// This function will handle attendee registration for an event
 	userId := context.GetInt64("userId")
-	stringEventId := context.Param("eventId")
-	if stringEventId == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Event ID is required!"})
+	event, err := requestedEvent(context)
+	if err != nil {
+		context.Error(err)
 		return
 	}
-	eventId, err := strconv.ParseInt(stringEventId, 10, 64)
+
+	// The body is optional, it only carries the ticket type and discount code choices
+	var request dto.RegistrationRequest
+	if context.Request.ContentLength != 0 {
+		err = context.ShouldBindJSON(&request)
+		if err != nil {
+			context.Error(validation.Error(err))
+			return
+		}
+	}
+
+	registration, err := event.RegisterForEvent(context.Request.Context(), userId, request.Model())
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Failed to parse event Id!"})
+		context.Error(wrapError(err, "Failed to register for the event"))
 		return
 	}
 
-	event, err := models.GetEvent(eventId)
+	metrics.RegistrationsCreated.Inc()
+	ticket, err := utils.GenerateTicketToken(event.Id, userId, event.EndTime)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event from the database!"})
+		context.Error(apperrors.Internal("Failed to sign ticket", err))
 		return
 	}
+	context.JSON(http.StatusCreated, gin.H{"message": "Successfully registered for the event!", "registration": present(context, registration), "ticket": ticket})
+}
 
-	err = event.RegisterForEvent(userId)
+func cancelRegistration(context *gin.Context) {
+	// This function will handle attendee cancellation for an event
+	userId := context.GetInt64("userId")
+	event, err := requestedEvent(context)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to register for the event!"})
+		context.Error(err)
+		return
+	}
+
+	refund, err := event.CancelRegistration(context.Request.Context(), userId)
+	if err != nil && refund == nil {
+		context.Error(wrapError(err, "Failed to cancel registration for the event"))
 		return
 	}
+	metrics.RegistrationsCancelled.Inc()
+	if err != nil {
+		// The failed refund is recorded and retried in the background, the cancellation itself went through
+		logger.FromContext(context).Warn("refund failed after cancelling registration", "error", err)
+	}
 
-	context.JSON(http.StatusCreated, gin.H{"message": "Successfully registered for the event!"})
+	context.JSON(http.StatusOK, gin.H{"message": "Successfully cancelled registration for the event!", "refund": present(context, refund)})
 }
 
-func cancelRegistration(context *gin.Context) {
-	// This function will handle attendee cancellation for an event
+func getTicket(context *gin.Context) {
+	// This function will handle rendering the attendee's ticket as a QR code
 	userId := context.GetInt64("userId")
-	stringEventId := context.Param("eventId")
-	if stringEventId == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Event ID is required!"})
+	event, err := requestedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	_, err = models.GetRegistration(context.Request.Context(), event.Id, userId)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve registration from the database"))
 		return
 	}
-	eventId, err := strconv.ParseInt(stringEventId, 10, 64)
+
+	ticket, err := utils.GenerateTicketToken(event.Id, userId, event.EndTime)
+	if err != nil {
+		context.Error(apperrors.Internal("Failed to sign ticket", err))
+		return
+	}
+	png, err := qrcode.Encode(ticket, qrcode.Medium, 256)
+	if err != nil {
+		context.Error(apperrors.Internal("Failed to render ticket", err))
+		return
+	}
+
+	context.Data(http.StatusOK, "image/png", png)
+}
+
+func checkIn(context *gin.Context) {
+	// This function will handle checking in an attendee by scanning their ticket
+	event, err := organizedEvent(context)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Failed to parse event Id!"})
+		context.Error(err)
 		return
 	}
 
-	event, err := models.GetEvent(eventId)
+	var input dto.CheckIn
+	err = context.ShouldBindJSON(&input)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to retrieve event from the database!"})
+		context.Error(validation.Error(err))
 		return
 	}
 
-	err = event.CancelRegistration(userId)
+	ticketEventId, attendeeId, err := utils.VerifyTicketToken(input.Ticket)
+	if errors.Is(err, utils.ErrTicketExpired) {
+		context.Error(apperrors.BadRequest("expired_ticket", "Ticket expired when the event ended"))
+		return
+	}
+	if err != nil {
+		context.Error(apperrors.BadRequest("invalid_ticket", "Invalid ticket"))
+		return
+	}
+	if ticketEventId != event.Id {
+		context.Error(apperrors.BadRequest("ticket_event_mismatch", "Ticket was issued for another event"))
+		return
+	}
+
+	registration, err := event.CheckIn(context.Request.Context(), attendeeId)
+	if errors.Is(err, models.ErrAlreadyCheckedIn) {
+		context.Error(models.ErrAlreadyCheckedIn.With("registration", present(context, registration)))
+		return
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to cancel registration for the event!"})
+		context.Error(wrapError(err, "Failed to check in attendee"))
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Successfully cancelled registration for the event!"})
+	context.JSON(http.StatusOK, gin.H{"message": "Attendee checked in successfully!", "registration": present(context, registration)})
 }
@@ -1,26 +1,114 @@
 package routes
 
 import (
+	"net/http"
+	"time"
+
+	"github.com/ftilie/go-booking-api/metrics"
 	"github.com/ftilie/go-booking-api/middlewares"
+	"github.com/ftilie/go-booking-api/openapi"
+	"github.com/ftilie/go-booking-api/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(server *gin.Engine) {
-	authenticated := server.Group("/events").Use(middlewares.Authenticate) // Create a group for authenticated routes
+// The versions of the API. Each one is mounted side by side under its own prefix, so a version with
+// different request or response shapes can be added without breaking the clients of the older ones.
+// They share their handlers, which shape their responses for the version of the request with present.
+var (
+	V2 = &middlewares.APIVersion{Name: "v2", Prefix: "/v2"} // camelCase documents from the dto package
+
+	V1 = &middlewares.APIVersion{Name: "v1", Prefix: "/v1"} // Serializes the models as they are
+
+	// Legacy is the original unversioned API, it behaves exactly like v1 until it is switched off
+	Legacy = &middlewares.APIVersion{
+		Name:         "legacy",
+		DeprecatedAt: time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		Sunset:       time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC),
+		Successor:    V1,
+	}
+)
+
+// RateLimits holds the limits of each group of routes, a zero Limit leaves its group unlimited.
+// Every version of the API counts against the same buckets.
+type RateLimits struct {
+	Store ratelimit.Store
+	Auth  ratelimit.Limit // Signing up and logging in, per client IP
+	Read  ratelimit.Limit // Reading events, per user, and calendar feeds, per client IP
+	Write ratelimit.Limit // Every other change, per user
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Store: ratelimit.NewMemoryStore(),
+		Auth:  ratelimit.PerMinute(10, 5),
+		Read:  ratelimit.PerMinute(300, 60),
+		Write: ratelimit.PerMinute(60, 20),
+	}
+}
+
+func RegisterRoutes(server *gin.Engine, rateLimits RateLimits) {
+	registerAPI(server.Group(V2.Prefix, middlewares.Versioned(V2)), rateLimits)
+	registerAPI(server.Group(V1.Prefix, middlewares.Versioned(V1)), rateLimits)
+	registerAPI(server.Group(Legacy.Prefix, middlewares.Versioned(Legacy)), rateLimits)
+
+	// Register the routes for monitoring, they are not part of any API version
+	server.GET("/metrics", metrics.Handler())
+	server.GET("/healthz", getHealth)
+	server.GET("/readyz", getReadiness)
+	server.GET("/version", getVersion)
+
+	// Register the routes for the services verifying our tokens
+	server.GET("/.well-known/jwks.json", getJWKS)
+
+	// Register the routes for the documentation
+	server.GET("/openapi.json", getOpenAPI)
+	server.GET("/docs/*file", middlewares.ContentSecurityPolicy(middlewares.DocsContentSecurityPolicy), gin.WrapH(http.StripPrefix("/docs", openapi.DocsHandler())))
+
+	// Unknown routes are reported as problem details like every other error
+	server.NoRoute(routeNotFound)
+}
+
+func registerAPI(router *gin.RouterGroup, rateLimits RateLimits) {
+	authLimit := middlewares.RateLimit(rateLimits.Store, "auth", rateLimits.Auth)
+	readLimit := middlewares.RateLimit(rateLimits.Store, "read", rateLimits.Read)
+	writeLimit := middlewares.RateLimit(rateLimits.Store, "write", rateLimits.Write)
+
+	authenticated := router.Group("/events", middlewares.Authenticate) // Create a group for authenticated routes
+	reads := authenticated.Group("", readLimit)
+	writes := authenticated.Group("", writeLimit)
 
 	// Register the routes for the events
-	authenticated.GET("/", getEvents)
-	authenticated.GET("/:eventId", getEvent)
-	authenticated.POST("/", createEvent)
-	authenticated.PUT("/:eventId", updateEvent)
-	authenticated.DELETE("/:eventId", deleteEvent)
+	reads.GET("/", getEvents)
+	reads.GET("/:eventId", getEvent)
+	writes.POST("/", middlewares.Idempotency, createEvent)
+	writes.POST("/import", importEvents)
+	writes.PATCH("/:eventId", updateEvent)
+	writes.PUT("/:eventId", updateEvent) // Kept for existing clients, behaves like PATCH with a merge patch
+	writes.DELETE("/:eventId", deleteEvent)
 
 	// Register the routes for the users
-	server.POST("/signup", signup)
-	server.POST("/login", login)
+	router.POST("/signup", authLimit, signup)
+	router.POST("/login", authLimit, login)
+	router.POST("/logout", middlewares.Authenticate, writeLimit, logout)
 
 	// Register the routes for the bookings
-	authenticated.POST("/:eventId/registration", registerForEvent)
-	authenticated.DELETE("/:eventId/registration", cancelRegistration)
+	writes.POST("/:eventId/registration", middlewares.Idempotency, registerForEvent)
+	writes.DELETE("/:eventId/registration", cancelRegistration)
+	reads.GET("/:eventId/registration/ticket", getTicket)
+	writes.POST("/:eventId/check-in", checkIn)
+
+	// Register the routes for the calendar exports
+	reads.GET("/:eventId/ics", getEventCalendar)
+	router.POST("/calendar/feed", middlewares.Authenticate, writeLimit, resetCalendarFeed)
+	router.GET("/calendar/:token/events.ics", readLimit, getCalendarFeed)
+
+	// Register the routes for the refunds
+	writes.PUT("/:eventId/cancellation-policy", updateCancellationPolicy)
+	reads.GET("/:eventId/refunds", getRefunds)
 
+	// Register the routes for the ticket types and discount codes
+	reads.GET("/:eventId/ticket-types", getTicketTypes)
+	writes.POST("/:eventId/ticket-types", createTicketType)
+	reads.GET("/:eventId/discount-codes", getDiscountCodes)
+	writes.POST("/:eventId/discount-codes", createDiscountCode)
 }
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ftilie/go-booking-api/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+var pathParameter = regexp.MustCompile(`[:*](\w+)`)
+
+func specPath(route string) string {
+	// Gin writes parameters as :name or *name, OpenAPI as {name}
+	path := pathParameter.ReplaceAllString(route, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	RegisterRoutes(server, RateLimits{})
+
+	paths, err := openapi.Paths()
+	if err != nil {
+		t.Fatalf("openapi.json is not a valid document: %v", err)
+	}
+
+	routes := map[string]bool{}
+	for _, route := range server.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+
+	registered := map[string]bool{}
+	for _, route := range server.Routes() {
+		// The unversioned aliases are not documented, each must still mirror a route of its successor
+		if routes[route.Method+" "+Legacy.Successor.Prefix+route.Path] {
+			continue
+		}
+		path := specPath(route.Path)
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		operation, ok := paths[path][method]
+		if !ok {
+			t.Errorf("%s %s is registered but missing from openapi.json as %s %s", route.Method, route.Path, method, path)
+			continue
+		}
+		if operation.OperationId == "" {
+			t.Errorf("%s %s has no operationId in openapi.json", route.Method, path)
+		}
+	}
+
+	for path, operations := range paths {
+		for method := range operations {
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json describes %s %s but no such route is registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func getTicketTypes(context *gin.Context) {
+	// This function will handle listing the ticket types of an event
+	event, err := requestedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	ticketTypes, err := models.GetTicketTypes(context.Request.Context(), event.Id)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve ticket types from the database"))
+		return
+	}
+
+	context.JSON(http.StatusOK, present(context, ticketTypes))
+}
+
+func createTicketType(context *gin.Context) {
+	// This function will handle creating a new ticket type for an event
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	var request dto.NewTicketType
+	err = context.ShouldBindJSON(&request)
+	if err != nil {
+		context.Error(validation.Error(err))
+		return
+	}
+	ticketType := request.Model()
+	if err := validation.Validate(&ticketType); err != nil {
+		context.Error(err)
+		return
+	}
+
+	ticketType.EventId = event.Id
+	ticketType.CreatedAt = time.Now()
+
+	err = ticketType.CreateTicketType(context.Request.Context())
+	if err != nil {
+		context.Error(wrapError(err, "Failed to create ticket type in the database"))
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"message": "Ticket type created successfully!", "ticketType": present(context, ticketType)})
+}
+
+func getDiscountCodes(context *gin.Context) {
+	// This function will handle listing the discount codes of an event
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	codes, err := models.GetDiscountCodes(context.Request.Context(), event.Id)
+	if err != nil {
+		context.Error(wrapError(err, "Failed to retrieve discount codes from the database"))
+		return
+	}
+
+	context.JSON(http.StatusOK, present(context, codes))
+}
+
+func createDiscountCode(context *gin.Context) {
+	// This function will handle creating a new discount code for an event
+	event, err := organizedEvent(context)
+	if err != nil {
+		context.Error(err)
+		return
+	}
+
+	var request dto.NewDiscountCode
+	err = context.ShouldBindJSON(&request)
+	if err != nil {
+		context.Error(validation.Error(err))
+		return
+	}
+	code := request.Model()
+	if err := validation.Validate(&code); err != nil {
+		context.Error(err)
+		return
+	}
+
+	code.EventId = event.Id
+	code.UsedCount = 0
+	code.CreatedAt = time.Now()
+
+	err = code.CreateDiscountCode(context.Request.Context())
+	if err != nil {
+		context.Error(wrapError(err, "Failed to create discount code in the database"))
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"message": "Discount code created successfully!", "discountCode": present(context, code)})
+}
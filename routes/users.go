@@ -4,26 +4,32 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/ftilie/go-booking-api/dto"
+	"github.com/ftilie/go-booking-api/metrics"
+	"github.com/ftilie/go-booking-api/middlewares"
 	"github.com/ftilie/go-booking-api/models"
 	"github.com/ftilie/go-booking-api/utils"
+	"github.com/ftilie/go-booking-api/validation"
 	"github.com/gin-gonic/gin"
 )
 
 func signup(context *gin.Context) {
 	// This function will handle user signup
-	var user models.User
-	err := context.ShouldBindJSON(&user)
+	var request dto.Signup
+	err := context.ShouldBindJSON(&request)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input could not be parsed!"})
+		context.Error(validation.Error(err))
 		return
 	}
 
 	now := time.Now()
+	user := request.Model()
 	user.CreatedAt = &now
 
-	err = user.CreateUser()
+	err = user.CreateUser(context.Request.Context())
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create user in the database!"})
+		context.Error(wrapError(err, "Failed to create user in the database"))
 		return
 	}
 
@@ -32,28 +38,49 @@ func signup(context *gin.Context) {
 
 func login(context *gin.Context) {
 	// This function will handle user login
-	var user models.User
-	err := context.ShouldBindJSON(&user)
+	var request dto.Credentials
+	err := context.ShouldBindJSON(&request)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input could not be parsed!"})
+		context.Error(validation.Error(err))
+		return
+	}
+	user := request.Model()
+	if err := validation.Validate(&user); err != nil {
+		context.Error(err)
 		return
 	}
 
-	isAuthenticated, err := user.Authenticate()
+	isAuthenticated, err := user.Authenticate(context.Request.Context())
 	if err != nil {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed!"})
+		metrics.Logins.WithLabelValues("failure").Inc()
+		context.Error(wrapError(err, "Failed to authenticate user"))
 		return
 	}
 	if !isAuthenticated {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid username or password!"})
+		metrics.Logins.WithLabelValues("failure").Inc()
+		context.Error(models.ErrInvalidCredentials)
 		return
 	}
 
 	token, err := utils.GenerateToken(user.Id, user.Email) // Generate a token for the user
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate token!"})
+		context.Error(apperrors.Internal("Failed to generate token", err))
 		return
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	context.JSON(http.StatusOK, gin.H{"message": "User logged in successfully!", "token": token})
 }
+
+func logout(context *gin.Context) {
+	// This function will handle revoking the token the request was made with
+	claims := middlewares.TokenClaims(context)
+	// The token is denied for as long as it would otherwise be accepted
+	expiresAt := claims.ExpiresAt.Add(utils.Tokens.Leeway)
+	if err := models.RevokeToken(context.Request.Context(), claims.ID, expiresAt); err != nil {
+		context.Error(apperrors.Internal("Failed to revoke token", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "User logged out successfully!"})
+}
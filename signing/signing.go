@@ -0,0 +1,352 @@
+// Package signing keeps the keys tokens are signed with and rotates them on a schedule.
+//
+// Keys are stored in the database so every instance of the API signs and verifies with the same ones. A new key is
+// published in the JWKS as soon as it is created but only signs tokens once PublishAhead has passed, so services
+// caching the JWKS learn about it before they meet its tokens. The key it replaces keeps verifying tokens until the
+// last of them expired, then it is deleted. With an EncryptionKey the private keys are sealed with AES-GCM before they
+// are stored, and keys stored before it was configured are sealed the next time they are loaded.
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ftilie/go-booking-api/health"
+	"github.com/ftilie/go-booking-api/logger"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/utils"
+)
+
+const (
+	defaultRotationInterval = 30 * 24 * time.Hour
+	defaultPublishAhead     = time.Hour
+	rsaKeyBits              = 2048
+	rotationTimeout         = time.Minute
+	encryptionKeySize       = 32 // AES-256
+)
+
+var (
+	errUnknownKey         = errors.New("unknown signing key")
+	errNoEncryptionKey    = errors.New("the signing keys are encrypted but SIGNING_KEY_ENCRYPTION_KEY is not set")
+	errWrongEncryptionKey = errors.New("the signing key cannot be decrypted with SIGNING_KEY_ENCRYPTION_KEY")
+)
+
+// Options sets the algorithm and schedule of new keys
+type Options struct {
+	Algorithm        string        // Algorithm of the keys created from now on, utils.AlgorithmEdDSA or utils.AlgorithmRS256
+	RotationInterval time.Duration // How long a key signs before the next one is created
+	PublishAhead     time.Duration // How long a new key is published before it signs, longer than JWKS caches keep it
+	EncryptionKey    []byte        // AES-256 key the private keys are sealed with in the database, nil stores them unencrypted
+}
+
+func OptionsFromEnv() (Options, error) {
+	// Returns the options set by JWT_ALGORITHM, JWT_KEY_ROTATION and SIGNING_KEY_ENCRYPTION_KEY, e.g. EdDSA, 720h and
+	// 32 random bytes encoded in base64
+	options := Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: defaultRotationInterval, PublishAhead: defaultPublishAhead}
+	switch algorithm := os.Getenv("JWT_ALGORITHM"); algorithm {
+	case "":
+	case utils.AlgorithmEdDSA, utils.AlgorithmRS256:
+		options.Algorithm = algorithm
+	default:
+		return Options{}, errors.New("JWT_ALGORITHM must be EdDSA or RS256")
+	}
+	if value := os.Getenv("JWT_KEY_ROTATION"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= options.PublishAhead {
+			return Options{}, errors.New("JWT_KEY_ROTATION must be a duration longer than " + options.PublishAhead.String())
+		}
+		options.RotationInterval = interval
+	}
+	if value := os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(key) != encryptionKeySize {
+			return Options{}, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY must be %d bytes encoded in base64", encryptionKeySize)
+		}
+		options.EncryptionKey = key
+	}
+	return options, nil
+}
+
+// ringKey is a loaded key with the period it signs in, RetiresAt is zero while no later key is scheduled
+type ringKey struct {
+	utils.Key
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+}
+
+// expired reports whether every token the key signed has expired, allowing for the clock leeway
+func (k ringKey) expired(now time.Time) bool {
+	return !k.RetiresAt.IsZero() && !now.Before(k.RetiresAt.Add(utils.TokenLifetime+utils.Tokens.Leeway))
+}
+
+// Ring is the utils.KeySet of the server, it is safe for concurrent use
+type Ring struct {
+	options Options
+	mutex   sync.RWMutex
+	keys    []ringKey // In the order they activate
+	now     func() time.Time
+}
+
+func NewRing(ctx context.Context, options Options) (*Ring, error) {
+	// This function will load the stored keys, creating the first one when there is none yet
+	ring := &Ring{options: options, now: time.Now}
+	if err := ring.Rotate(ctx); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+func (r *Ring) load(ctx context.Context) error {
+	stored, err := models.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]ringKey, 0, len(stored))
+	for _, key := range stored {
+		der, err := r.unseal(ctx, key)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", key.Id, err)
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return err
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return errors.New("signing key " + key.Id + " cannot sign")
+		}
+		keys = append(keys, ringKey{
+			Key:         utils.Key{Id: key.Id, Algorithm: key.Algorithm, PrivateKey: signer},
+			CreatedAt:   key.CreatedAt,
+			ActivatesAt: key.ActivatesAt,
+		})
+	}
+	for i := 0; i+1 < len(keys); i++ {
+		keys[i].RetiresAt = keys[i+1].ActivatesAt
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keys = keys
+	return nil
+}
+
+func (r *Ring) Rotate(ctx context.Context) error {
+	// This function will reload the keys other instances may have created, create the next key when the latest one
+	// is due for rotation or uses another algorithm than configured, and delete the keys whose tokens all expired
+	if err := r.load(ctx); err != nil {
+		return err
+	}
+	now := r.now()
+
+	r.mutex.RLock()
+	keys := r.keys
+	r.mutex.RUnlock()
+
+	due := len(keys) == 0
+	if !due {
+		latest := keys[len(keys)-1]
+		due = !now.Before(latest.CreatedAt.Add(r.options.RotationInterval)) || latest.Algorithm != r.options.Algorithm
+	}
+	changed := false
+	if due {
+		activatesAt := now.Add(r.options.PublishAhead)
+		if _, err := r.signingKey(now); err != nil {
+			activatesAt = now // Nothing can sign meanwhile, the first key has nobody to be announced to
+		}
+		if err := r.createKey(ctx, now, activatesAt); err != nil {
+			return err
+		}
+		changed = true
+	}
+	for _, key := range keys {
+		if key.expired(now) {
+			if err := models.DeleteSigningKey(ctx, key.Id); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return r.load(ctx)
+}
+
+func (r *Ring) createKey(ctx context.Context, now, activatesAt time.Time) error {
+	privateKey, err := GenerateKey(r.options.Algorithm)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	key := models.SigningKey{
+		Id:          base64.RawURLEncoding.EncodeToString(id),
+		Algorithm:   r.options.Algorithm,
+		PrivateKey:  der,
+		CreatedAt:   now.UTC(),
+		ActivatesAt: activatesAt.UTC(), // Stored as text, a single time zone keeps them sorted
+	}
+	if r.options.EncryptionKey != nil {
+		if key.PrivateKey, err = sealKey(r.options.EncryptionKey, key.Id, der); err != nil {
+			return err
+		}
+		key.Encrypted = true
+	}
+	if err := key.CreateSigningKey(ctx); err != nil {
+		return err
+	}
+	logger.Log.Info("created signing key", "kid", key.Id, "algorithm", key.Algorithm, "activatesAt", key.ActivatesAt)
+	return nil
+}
+
+func (r *Ring) unseal(ctx context.Context, key models.SigningKey) ([]byte, error) {
+	// Returns the DER of a stored key, sealing it in the database first when it was stored before encryption was configured
+	if key.Encrypted {
+		if r.options.EncryptionKey == nil {
+			return nil, errNoEncryptionKey
+		}
+		return openKey(r.options.EncryptionKey, key.Id, key.PrivateKey)
+	}
+	if r.options.EncryptionKey != nil {
+		sealed, err := sealKey(r.options.EncryptionKey, key.Id, key.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := models.EncryptSigningKey(ctx, key.Id, sealed); err != nil {
+			return nil, err
+		}
+		logger.Log.Info("encrypted signing key", "kid", key.Id)
+	}
+	return key.PrivateKey, nil
+}
+
+// sealKey encrypts a private key with AES-GCM behind a random nonce. The key id is authenticated with it, so a sealed
+// key copied to another row does not open.
+func sealKey(encryptionKey []byte, id string, der []byte) ([]byte, error) {
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, der, []byte(id)), nil
+}
+
+func openKey(encryptionKey []byte, id string, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errWrongEncryptionKey
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	der, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, errWrongEncryptionKey
+	}
+	return der, nil
+}
+
+func newAEAD(encryptionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case utils.AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case utils.AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	return nil, errors.New("unsupported signing algorithm " + algorithm)
+}
+
+func (r *Ring) SigningKey() (utils.Key, error) {
+	return r.signingKey(r.now())
+}
+
+func (r *Ring) signingKey(now time.Time) (utils.Key, error) {
+	// The latest key that activated signs, later ones are only published so far
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if !now.Before(r.keys[i].ActivatesAt) {
+			return r.keys[i].Key, nil
+		}
+	}
+	return utils.Key{}, errors.New("no signing key is active")
+}
+
+func (r *Ring) VerificationKey(id string) (utils.Key, error) {
+	now := r.now()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, key := range r.keys {
+		if key.Id == id && !key.expired(now) {
+			return key.Key, nil
+		}
+	}
+	return utils.Key{}, errUnknownKey
+}
+
+func (r *Ring) PublishedKeys() []utils.Key {
+	now := r.now()
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	keys := make([]utils.Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.expired(now) {
+			keys = append(keys, key.Key)
+		}
+	}
+	return keys
+}
+
+func (r *Ring) Run(ctx context.Context, worker *health.Worker, interval time.Duration) {
+	// This function will rotate the keys every interval until the context is cancelled.
+	// The interval must be shorter than PublishAhead so every instance knows a key before it signs.
+	worker.SetRunning(true)
+	defer worker.SetRunning(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rotateCtx, cancel := context.WithTimeout(ctx, rotationTimeout)
+			err := r.Rotate(rotateCtx)
+			cancel()
+			if err != nil {
+				logger.Log.Error("failed to rotate the signing keys", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/models"
+	"github.com/ftilie/go-booking-api/utils"
+)
+
+// newTestRing returns a ring on its own database whose clock only moves when the returned function is called
+func newTestRing(t *testing.T, options Options) (*Ring, func(time.Duration)) {
+	t.Helper()
+	database.InitDB(filepath.Join(t.TempDir(), "booking.db"))
+	t.Cleanup(func() { database.DB.Close() })
+
+	now := time.Now().UTC()
+	ring := &Ring{options: options, now: func() time.Time { return now }}
+	if err := ring.Rotate(context.Background()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	return ring, func(duration time.Duration) { now = now.Add(duration) }
+}
+
+func rotate(t *testing.T, ring *Ring) {
+	t.Helper()
+	if err := ring.Rotate(context.Background()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+}
+
+func signingKeyId(t *testing.T, ring *Ring) string {
+	t.Helper()
+	key, err := ring.SigningKey()
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	return key.Id
+}
+
+func publishedIds(ring *Ring) []string {
+	var ids []string
+	for _, key := range ring.PublishedKeys() {
+		ids = append(ids, key.Id)
+	}
+	return ids
+}
+
+func TestRotation(t *testing.T) {
+	options := Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: 24 * time.Hour, PublishAhead: time.Hour}
+	ring, advance := newTestRing(t, options)
+
+	// The first key signs right away
+	first := signingKeyId(t, ring)
+	rotate(t, ring)
+	if ids := publishedIds(ring); len(ids) != 1 || ids[0] != first {
+		t.Fatalf("published %v, want only the first key", ids)
+	}
+
+	// Once due, the next key is published but the first one keeps signing
+	advance(options.RotationInterval)
+	rotate(t, ring)
+	ids := publishedIds(ring)
+	if len(ids) != 2 || ids[0] != first {
+		t.Fatalf("published %v, want the first key and the next one", ids)
+	}
+	second := ids[1]
+	if id := signingKeyId(t, ring); id != first {
+		t.Errorf("signing with %s before the next key activated, want %s", id, first)
+	}
+
+	// The next key signs after PublishAhead, the first one verifies the tokens it signed until they expired
+	advance(options.PublishAhead)
+	rotate(t, ring)
+	if id := signingKeyId(t, ring); id != second {
+		t.Errorf("signing with %s after the next key activated, want %s", id, second)
+	}
+	if _, err := ring.VerificationKey(first); err != nil {
+		t.Errorf("the retired key no longer verifies: %v", err)
+	}
+
+	advance(utils.TokenLifetime + utils.Tokens.Leeway)
+	rotate(t, ring)
+	if _, err := ring.VerificationKey(first); err == nil {
+		t.Error("the retired key still verifies after its tokens expired")
+	}
+	if ids := publishedIds(ring); len(ids) != 1 || ids[0] != second {
+		t.Errorf("published %v, want only the second key", ids)
+	}
+	stored, err := models.GetSigningKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Errorf("%d keys stored, want the expired one deleted", len(stored))
+	}
+}
+
+func TestRotationOnAlgorithmChange(t *testing.T) {
+	ring, _ := newTestRing(t, Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: 24 * time.Hour, PublishAhead: time.Hour})
+
+	ring.options.Algorithm = utils.AlgorithmRS256
+	rotate(t, ring)
+	keys := ring.PublishedKeys()
+	if len(keys) != 2 || keys[1].Algorithm != utils.AlgorithmRS256 {
+		t.Fatalf("published %+v, want an RS256 key next", keys)
+	}
+	rotate(t, ring)
+	if len(ring.PublishedKeys()) != 2 {
+		t.Error("the RS256 key was rotated again")
+	}
+}
+
+func TestRingsShareKeys(t *testing.T) {
+	// A second instance loads the keys the first one created instead of making its own
+	options := Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: 24 * time.Hour, PublishAhead: time.Hour}
+	ring, _ := newTestRing(t, options)
+	other, err := NewRing(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utils.Keys = ring
+	token, err := utils.GenerateToken(42, "ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Keys = other
+	if claims, err := utils.VerifyToken(token); err != nil || claims.UserId() != 42 {
+		t.Errorf("VerifyToken on another instance = %+v, %v", claims, err)
+	}
+}
+
+func storedKeys(t *testing.T) []models.SigningKey {
+	t.Helper()
+	stored, err := models.GetSigningKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestEncryptedKeys(t *testing.T) {
+	encryptionKey := bytes.Repeat([]byte{7}, encryptionKeySize)
+	options := Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: 24 * time.Hour, PublishAhead: time.Hour, EncryptionKey: encryptionKey}
+	ring, _ := newTestRing(t, options)
+
+	stored := storedKeys(t)
+	if len(stored) != 1 || !stored[0].Encrypted {
+		t.Fatalf("stored %+v, want one encrypted key", stored)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(stored[0].PrivateKey); err == nil {
+		t.Fatal("the private key is stored in plaintext")
+	}
+
+	// Another instance with the same encryption key signs with the same key
+	other, err := NewRing(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := signingKeyId(t, other); id != signingKeyId(t, ring) {
+		t.Errorf("signing with %s on another instance, want %s", id, signingKeyId(t, ring))
+	}
+
+	tests := []struct {
+		name          string
+		encryptionKey []byte
+		err           error
+	}{
+		{"without the encryption key", nil, errNoEncryptionKey},
+		{"with another encryption key", bytes.Repeat([]byte{8}, encryptionKeySize), errWrongEncryptionKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := options
+			options.EncryptionKey = test.encryptionKey
+			if _, err := NewRing(context.Background(), options); !errors.Is(err, test.err) {
+				t.Errorf("NewRing = %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	// A sealed key moved to another row does not open
+	if _, err := openKey(encryptionKey, "another-kid", stored[0].PrivateKey); !errors.Is(err, errWrongEncryptionKey) {
+		t.Errorf("opening a key under another id = %v, want %v", err, errWrongEncryptionKey)
+	}
+}
+
+func TestEncryptingStoredKeys(t *testing.T) {
+	// Keys stored before encryption was configured are sealed in place the next time they are loaded
+	options := Options{Algorithm: utils.AlgorithmEdDSA, RotationInterval: 24 * time.Hour, PublishAhead: time.Hour}
+	ring, _ := newTestRing(t, options)
+	id := signingKeyId(t, ring)
+	if stored := storedKeys(t); stored[0].Encrypted {
+		t.Fatal("the key was encrypted without an encryption key")
+	}
+
+	options.EncryptionKey = bytes.Repeat([]byte{7}, encryptionKeySize)
+	encrypted, err := NewRing(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signingId := signingKeyId(t, encrypted); signingId != id {
+		t.Errorf("signing with %s after encrypting, want %s", signingId, id)
+	}
+	stored := storedKeys(t)
+	if len(stored) != 1 || !stored[0].Encrypted {
+		t.Fatalf("stored %+v, want the key encrypted", stored)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(stored[0].PrivateKey); err == nil {
+		t.Error("the private key is still stored in plaintext")
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		size  int
+		valid bool
+	}{
+		{"unset", "", 0, true},
+		{"32 bytes", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)), 32, true},
+		{"16 bytes", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 16)), 0, false},
+		{"not base64", "not base64!", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SIGNING_KEY_ENCRYPTION_KEY", test.value)
+			options, err := OptionsFromEnv()
+			if (err == nil) != test.valid {
+				t.Fatalf("OptionsFromEnv error = %v, want valid %v", err, test.valid)
+			}
+			if len(options.EncryptionKey) != test.size {
+				t.Errorf("got a %d byte encryption key, want %d", len(options.EncryptionKey), test.size)
+			}
+		})
+	}
+}
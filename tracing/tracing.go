@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+)
+
+const ServiceName = "go-booking-api"
+
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	// This function will install the global tracer provider and the W3C trace context propagator.
+	// Spans are exported over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or the traces specific variant) is set,
+	// the exporter reads the rest of its configuration from the standard OTEL_* variables.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		// Without an exporter spans are still created so trace context is propagated to downstream services
+		provider := NewProvider()
+		otel.SetTracerProvider(provider)
+		return provider.Shutdown, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := NewProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func NewProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	// Builds a tracer provider for this service, tests can pass
+	// sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) to inspect the recorded spans
+	defaults := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName))),
+	}
+	return sdktrace.NewTracerProvider(append(defaults, options...)...)
+}
@@ -0,0 +1,85 @@
+package tracing_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ftilie/go-booking-api/database"
+	"github.com/ftilie/go-booking-api/middlewares"
+	"github.com/ftilie/go-booking-api/routes"
+	"github.com/ftilie/go-booking-api/tracing"
+	"github.com/ftilie/go-booking-api/validation"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestSpans(t *testing.T) {
+	// A request records a server span, the model calls it makes as its children and their SQL statements below them
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(t.Context())
+		otel.SetTracerProvider(previous)
+	})
+
+	gin.SetMode(gin.TestMode)
+	validation.Register()
+	database.InitDB(filepath.Join(t.TempDir(), "booking.db"))
+	t.Cleanup(func() { database.DB.Close() })
+	engine := gin.New()
+	engine.Use(otelgin.Middleware(tracing.ServiceName), middlewares.Errors)
+	routes.RegisterRoutes(engine, routes.RateLimits{})
+	exporter.Reset() // Only the spans of the request are checked, not the ones of the schema creation
+
+	body := bytes.NewBufferString(`{"email":"ana@example.com","password":"Passw0rd!long"}`)
+	request := httptest.NewRequest(http.MethodPost, "/v2/signup", body)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("signup returned %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	var server, model *tracetest.SpanStub
+	var statements []tracetest.SpanStub
+	for i, span := range spans {
+		switch {
+		case span.SpanKind == trace.SpanKindServer:
+			server = &spans[i]
+		case span.Name == "models.CreateUser":
+			model = &spans[i]
+		case strings.HasPrefix(span.Name, "sql."):
+			statements = append(statements, span)
+		}
+	}
+	if server == nil || model == nil {
+		t.Fatalf("recorded %d spans without both the server span and models.CreateUser", len(spans))
+	}
+	if server.Parent.IsValid() {
+		t.Errorf("the server span has parent %s, want it to start the trace", server.Parent.SpanID())
+	}
+	if model.Parent.SpanID() != server.SpanContext.SpanID() || model.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("models.CreateUser is not a child of the server span")
+	}
+
+	children := 0
+	for _, statement := range statements {
+		if statement.Parent.SpanID() == model.SpanContext.SpanID() {
+			children++
+		}
+	}
+	if children == 0 {
+		t.Errorf("none of the %d SQL spans is a child of models.CreateUser", len(statements))
+	}
+}
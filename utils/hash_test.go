@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("Passw0rd!long")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if hash == "Passw0rd!long" || !strings.HasPrefix(hash, "$2a$") {
+		t.Fatalf("HashPassword() = %q, want a bcrypt hash", hash)
+	}
+
+	again, err := HashPassword("Passw0rd!long")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if again == hash {
+		t.Fatal("HashPassword() returned the same hash twice, the salt is missing")
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	hash, err := HashPassword("Passw0rd!long")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		want     bool
+	}{
+		{"matching password", "Passw0rd!long", hash, true},
+		{"wrong password", "Passw0rd!lonG", hash, false},
+		{"empty password", "", hash, false},
+		{"not a hash", "Passw0rd!long", "Passw0rd!long", false},
+		{"empty hash", "Passw0rd!long", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CheckPasswordHash(test.password, test.hash); got != test.want {
+				t.Fatalf("CheckPasswordHash() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
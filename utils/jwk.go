@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JSONWebKey is the public half of a Key, as published in a JSON Web Key Set (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Id        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"` // OKP keys (RFC 8037)
+	X         string `json:"x,omitempty"`
+	Modulus   string `json:"n,omitempty"` // RSA keys (RFC 7518)
+	Exponent  string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewJSONWebKeySet(keys []Key) JSONWebKeySet {
+	// Returns the public keys, keys of an unknown type are left out
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range keys {
+		jwk := JSONWebKey{Id: key.Id, Algorithm: key.Algorithm, Use: "sig"}
+		switch public := key.PrivateKey.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType, jwk.Curve, jwk.X = "OKP", "Ed25519", base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
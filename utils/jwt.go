@@ -1,53 +1,175 @@
 package utils
 
 import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const secretKey = "dummy_secret_key" // This should be injected in a CI pipeline
+// TokenLifetime is how long the tokens issued at login are valid
+const TokenLifetime = 2 * time.Hour
+
+// Algorithms tokens can be signed with, other services verify them with the public keys only
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var signingMethods = map[string]jwt.SigningMethod{
+	AlgorithmRS256: jwt.SigningMethodRS256,
+	AlgorithmEdDSA: jwt.SigningMethodEdDSA,
+}
+
+// Key is a key pair tokens are signed with, named in their kid header
+type Key struct {
+	Id         string
+	Algorithm  string
+	PrivateKey crypto.Signer // *rsa.PrivateKey for RS256, ed25519.PrivateKey for EdDSA
+}
+
+// KeySet provides the keys tokens are signed and verified with
+type KeySet interface {
+	SigningKey() (Key, error)               // The key new tokens are signed with
+	VerificationKey(id string) (Key, error) // The key named by a token, as long as its tokens may still be valid
+	PublishedKeys() []Key                   // The keys other services should accept, including ones about to sign
+}
+
+// Keys is the key set of the server, it must be set before tokens are generated or verified
+var Keys KeySet
+
+// TokenOptions are the registered claims tokens are issued with and checked against
+type TokenOptions struct {
+	Issuer   string        // iss of the tokens we issue, tokens of other issuers are rejected
+	Audience string        // aud of the tokens we issue, tokens meant for other audiences are rejected
+	Leeway   time.Duration // Clock difference with other servers tolerated when checking exp, nbf and iat
+}
+
+const (
+	defaultIssuer   = "go-booking-api"
+	defaultAudience = "go-booking-api"
+	defaultLeeway   = 30 * time.Second
+	maxLeeway       = 5 * time.Minute
+)
+
+// Tokens holds the options tokens are issued and verified with
+var Tokens = TokenOptions{Issuer: defaultIssuer, Audience: defaultAudience, Leeway: defaultLeeway}
+
+func TokenOptionsFromEnv() (TokenOptions, error) {
+	// Returns the options set by JWT_ISSUER, JWT_AUDIENCE and JWT_LEEWAY, e.g. 30s
+	options := TokenOptions{Issuer: defaultIssuer, Audience: defaultAudience, Leeway: defaultLeeway}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		options.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		options.Audience = audience
+	}
+	if value := os.Getenv("JWT_LEEWAY"); value != "" {
+		leeway, err := time.ParseDuration(value)
+		if err != nil || leeway < 0 || leeway > maxLeeway {
+			return TokenOptions{}, errors.New("JWT_LEEWAY must be a duration of at most " + maxLeeway.String())
+		}
+		options.Leeway = leeway
+	}
+	return options, nil
+}
+
+// Claims are the claims of the tokens issued at login, the subject is the ID of the user
+type Claims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+func (c Claims) UserId() int64 {
+	// Returns the user named by the subject, 0 unless it is the canonical decimal form of a valid ID
+	userId, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || userId < 1 || strconv.FormatInt(userId, 10) != c.Subject {
+		return 0
+	}
+	return userId
+}
+
+var errNoKeys = errors.New("no signing keys are configured")
 
 func GenerateToken(userId int64, email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": userId,
-		"email":  email,
-		"exp":    time.Now().Add(time.Hour * 2).Unix(), // Token valid for 2 hours
+	if Keys == nil {
+		return "", errNoKeys
+	}
+	key, err := Keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	method, ok := signingMethods[key.Algorithm]
+	if !ok {
+		return "", errors.New("unsupported signing algorithm " + key.Algorithm)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Tokens.Issuer,
+			Subject:   strconv.FormatInt(userId, 10),
+			Audience:  jwt.ClaimStrings{Tokens.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(TokenLifetime)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        base64.RawURLEncoding.EncodeToString(id), // Names the token when it is revoked
+		},
+		Email: email,
 	})
+	token.Header["kid"] = key.Id // Verifiers pick the public key from the published ones by this ID
 
-	return token.SignedString([]byte(secretKey))
+	return token.SignedString(key.PrivateKey)
 }
 
-func VerifyToken(token string) (int64, error) {
-	// This function will verify the JWT token
-	extractedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
+func VerifyToken(token string) (*Claims, error) {
+	// This function will verify the signature and the registered claims of the token.
+	// Whether it was revoked is up to the caller, the denylist is kept in the database.
+	if Keys == nil {
+		return nil, errNoKeys
+	}
+	claims := &Claims{}
+	extractedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, err := Keys.VerificationKey(id)
+		if err != nil {
+			return nil, err
+		}
+		// Each key only verifies the algorithm it was made for, so a token cannot pick a weaker one
+		if token.Method.Alg() != key.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secretKey), nil
-	})
+		return key.PrivateKey.Public(), nil
+	},
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithIssuer(Tokens.Issuer),
+		jwt.WithAudience(Tokens.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(Tokens.Leeway),
+	)
 	if err != nil {
-		return 0, errors.New("could not parse token")
+		return nil, errors.New("could not parse token")
 	}
 
 	if !extractedToken.Valid {
-		return 0, errors.New("token is not valid")
+		return nil, errors.New("token is not valid")
 	}
 
-	claims, ok := extractedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("token claims are not valid")
+	// The claims are only trusted to be well formed JSON, a token signed with our key may still lack a user
+	if claims.UserId() == 0 {
+		return nil, errors.New("token has no valid user")
 	}
-	if exp, ok := claims["exp"].(float64); ok {
-		if time.Now().Unix() > int64(exp) {
-			return 0, errors.New("token has expired")
-		}
+	if claims.ID == "" {
+		return nil, errors.New("token has no ID") // It could not be revoked
 	}
 
-	// email := claims["email"].(string)
-	userId := int64(claims["userId"].(float64))
-
-	return userId, nil
+	return claims, nil
 }
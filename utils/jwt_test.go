@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys signs with its first key and verifies with all of them
+type testKeys []Key
+
+func (k testKeys) SigningKey() (Key, error) {
+	return k[0], nil
+}
+
+func (k testKeys) VerificationKey(id string) (Key, error) {
+	for _, key := range k {
+		if key.Id == id {
+			return key, nil
+		}
+	}
+	return Key{}, os.ErrNotExist
+}
+
+func (k testKeys) PublishedKeys() []Key {
+	return k
+}
+
+var edKey, rsaKey Key
+
+func TestMain(m *testing.M) {
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	edKey = Key{Id: "ed", Algorithm: AlgorithmEdDSA, PrivateKey: edPrivate}
+	rsaKey = Key{Id: "rsa", Algorithm: AlgorithmRS256, PrivateKey: rsaPrivate}
+	Keys = testKeys{edKey, rsaKey}
+	os.Exit(m.Run())
+}
+
+func signedToken(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+// claims returns the claims of a token we could have issued to user 7, changed by the given ones, nil deletes a claim
+func claims(changes jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": Tokens.Issuer,
+		"aud": Tokens.Audience,
+		"sub": "7",
+		"exp": now.Add(time.Hour).Unix(),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"jti": "token-7",
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerifyToken(t *testing.T) {
+	valid, err := GenerateToken(42, "ana@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	now := time.Now()
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	ed := func(changes jwt.MapClaims) string {
+		return signedToken(t, jwt.SigningMethodEdDSA, edKey.Id, edKey.PrivateKey, claims(changes))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		userId  int64
+		wantErr bool
+	}{
+		{"generated token", valid, 42, false},
+		{"RS256 key", signedToken(t, jwt.SigningMethodRS256, rsaKey.Id, rsaKey.PrivateKey, claims(nil)), 7, false},
+		{"registered claims", ed(nil), 7, false},
+		{"audience list", ed(jwt.MapClaims{"aud": []string{"billing", Tokens.Audience}}), 7, false},
+		{"expired within the leeway", ed(jwt.MapClaims{"exp": now.Add(-Tokens.Leeway / 2).Unix()}), 7, false},
+		{"expired", ed(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}), 0, true},
+		{"no expiry", ed(jwt.MapClaims{"exp": nil}), 0, true},
+		{"not yet valid within the leeway", ed(jwt.MapClaims{"nbf": now.Add(Tokens.Leeway / 2).Unix()}), 7, false},
+		{"not yet valid", ed(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}), 0, true},
+		{"issued in the future", ed(jwt.MapClaims{"iat": now.Add(time.Minute).Unix()}), 0, true},
+		{"other issuer", ed(jwt.MapClaims{"iss": "someone-else"}), 0, true},
+		{"no issuer", ed(jwt.MapClaims{"iss": nil}), 0, true},
+		{"other audience", ed(jwt.MapClaims{"aud": "billing"}), 0, true},
+		{"no audience", ed(jwt.MapClaims{"aud": nil}), 0, true},
+		{"no ID", ed(jwt.MapClaims{"jti": nil}), 0, true},
+		{"missing user", ed(jwt.MapClaims{"sub": nil}), 0, true},
+		{"user as number", ed(jwt.MapClaims{"sub": 7}), 0, true},
+		{"user with leading zero", ed(jwt.MapClaims{"sub": "07"}), 0, true},
+		{"negative user", ed(jwt.MapClaims{"sub": "-7"}), 0, true},
+		{"user too large", ed(jwt.MapClaims{"sub": "99999999999999999999"}), 0, true},
+		{"former userId claim", ed(jwt.MapClaims{"sub": nil, "userId": 7}), 0, true},
+		{"wrong key", signedToken(t, jwt.SigningMethodEdDSA, edKey.Id, otherKey, claims(nil)), 0, true},
+		{"unknown key", signedToken(t, jwt.SigningMethodEdDSA, "retired", edKey.PrivateKey, claims(nil)), 0, true},
+		{"missing key id", signedToken(t, jwt.SigningMethodEdDSA, "", edKey.PrivateKey, claims(nil)), 0, true},
+		{"algorithm of another key", signedToken(t, jwt.SigningMethodRS256, edKey.Id, rsaKey.PrivateKey, claims(nil)), 0, true},
+		{"former HS256 secret", signedToken(t, jwt.SigningMethodHS256, "", []byte("dummy_secret_key"), claims(nil)), 0, true},
+		{"none algorithm", signedToken(t, jwt.SigningMethodNone, edKey.Id, jwt.UnsafeAllowNoneSignatureType, claims(nil)), 0, true},
+		{"tampered payload", valid[:len(valid)-2] + "xx", 0, true},
+		{"empty", "", 0, true},
+		{"garbage", "not.a.token", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := VerifyToken(test.token)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("VerifyToken() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && claims.UserId() != test.userId {
+				t.Fatalf("VerifyToken() userId = %d, want %d", claims.UserId(), test.userId)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenClaims(t *testing.T) {
+	first, err := GenerateToken(42, "ana@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	second, err := GenerateToken(42, "ana@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := VerifyToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != Tokens.Issuer || len(claims.Audience) != 1 || claims.Audience[0] != Tokens.Audience {
+		t.Errorf("issued by %q for %v, want %q for %q", claims.Issuer, claims.Audience, Tokens.Issuer, Tokens.Audience)
+	}
+	if claims.Subject != "42" || claims.Email != "ana@example.com" {
+		t.Errorf("subject %q and email %q, want 42 and ana@example.com", claims.Subject, claims.Email)
+	}
+	if claims.IssuedAt == nil || claims.NotBefore == nil || !claims.ExpiresAt.Time.Equal(claims.IssuedAt.Add(TokenLifetime)) {
+		t.Errorf("issued at %v, valid from %v until %v", claims.IssuedAt, claims.NotBefore, claims.ExpiresAt)
+	}
+	other, err := VerifyToken(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID == "" || claims.ID == other.ID {
+		t.Errorf("token IDs %q and %q, want distinct IDs", claims.ID, other.ID)
+	}
+}
+
+func TestTokenOptionsFromEnv(t *testing.T) {
+	t.Setenv("JWT_ISSUER", "https://auth.example.com")
+	t.Setenv("JWT_AUDIENCE", "")
+	t.Setenv("JWT_LEEWAY", "1m")
+	options, err := TokenOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Issuer != "https://auth.example.com" || options.Audience != defaultAudience || options.Leeway != time.Minute {
+		t.Errorf("got %+v", options)
+	}
+
+	for _, leeway := range []string{"-1s", "1h", "soon"} {
+		t.Setenv("JWT_LEEWAY", leeway)
+		if _, err := TokenOptionsFromEnv(); err == nil {
+			t.Errorf("JWT_LEEWAY=%s was accepted", leeway)
+		}
+	}
+}
+
+func TestGenerateTokenKeyId(t *testing.T) {
+	token, err := GenerateToken(42, "ana@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != edKey.Id || parsed.Header["alg"] != AlgorithmEdDSA {
+		t.Errorf("header = %v, want the kid and algorithm of the signing key", parsed.Header)
+	}
+}
+
+func TestJSONWebKeySet(t *testing.T) {
+	encoded, err := json.Marshal(NewJSONWebKeySet(Keys.PublishedKeys()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(encoded, &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(set.Keys))
+	}
+	if ed := set.Keys[0]; ed["kty"] != "OKP" || ed["crv"] != "Ed25519" || ed["kid"] != "ed" || ed["x"] == "" || ed["d"] != "" {
+		t.Errorf("Ed25519 key = %v", ed)
+	}
+	if rsa := set.Keys[1]; rsa["kty"] != "RSA" || rsa["alg"] != AlgorithmRS256 || rsa["n"] == "" || rsa["e"] != "AQAB" {
+		t.Errorf("RSA key = %v", rsa)
+	}
+}
+
+// signClaims signs a raw JSON payload with the server key, as if the token had been issued by us
+func signClaims(t *testing.T, payload []byte) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT","kid":"` + edKey.Id + `"}`))
+	signingString := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := jwt.SigningMethodEdDSA.Sign(signingString, edKey.PrivateKey)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func FuzzVerifyToken(f *testing.F) {
+	// Arbitrary strings must be rejected without panicking
+	valid, err := GenerateToken(42, "ana@example.com")
+	if err != nil {
+		f.Fatalf("GenerateToken: %v", err)
+	}
+	f.Add(valid)
+	f.Add(valid[:len(valid)/2])
+	f.Add("")
+	f.Add("..")
+	f.Add("eyJhbGciOiJub25lIn0.eyJ1c2VySWQiOjF9.")
+	f.Add("eyJhbGciOiJIUzI1NiJ9.e30.AAAA")
+	f.Add("eyJhbGciOiJFZERTQSIsImtpZCI6ImVkIn0.e30.AAAA")
+
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := VerifyToken(token)
+		if err == nil && claims.UserId() < 1 {
+			t.Fatalf("VerifyToken(%q) accepted user %d", token, claims.UserId())
+		}
+	})
+}
+
+func FuzzVerifyTokenClaims(f *testing.F) {
+	// Tokens carrying a valid signature but arbitrary claims must be rejected without panicking,
+	// and an accepted token must name a positive user
+	valid, err := json.Marshal(claims(nil))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+	f.Add([]byte(`{"sub":"42","email":"ana@example.com"}`))
+	f.Add([]byte(`{"sub":42,"iss":"go-booking-api","aud":"go-booking-api","exp":1e30,"jti":"x"}`))
+	f.Add([]byte(`{"sub":null,"aud":[null]}`))
+	f.Add([]byte(`{"sub":"1","exp":"tomorrow"}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		claims, err := VerifyToken(signClaims(t, payload))
+		if err == nil && (claims.UserId() < 1 || claims.ID == "") {
+			t.Fatalf("VerifyToken accepted claims %s", payload)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Tickets of version t1 were signed with a key published in the repository and never expired, they are rejected
+const ticketTokenVersion = "t2"
+
+const minTicketSecretSize = 32
+
+// TicketSecret is the key tickets are signed with, it must be set before tickets are generated or verified
+var TicketSecret []byte
+
+var (
+	ErrTicketExpired  = errors.New("ticket expired")
+	errNoTicketSecret = errors.New("no ticket secret is configured")
+)
+
+func TicketSecretFromEnv() ([]byte, error) {
+	// Returns the key set by TICKET_SECRET, encoded in base64, or nil when it is not set
+	value := os.Getenv("TICKET_SECRET")
+	if value == "" {
+		return nil, nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(secret) < minTicketSecretSize {
+		return nil, fmt.Errorf("TICKET_SECRET must be at least %d bytes encoded in base64", minTicketSecretSize)
+	}
+	return secret, nil
+}
+
+func GenerateTicketToken(eventId, userId int64, expiresAt time.Time) (string, error) {
+	// This function will sign the ticket so check-in devices can verify it without a database lookup.
+	// The ticket is valid until expiresAt, the end of the event.
+	payload := fmt.Sprintf("%s.%d.%d.%d", ticketTokenVersion, eventId, userId, expiresAt.Unix())
+	encodedPayload := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	signature, err := signTicketPayload(encodedPayload)
+	if err != nil {
+		return "", err
+	}
+	return encodedPayload + "." + signature, nil
+}
+
+func VerifyTicketToken(token string) (int64, int64, error) {
+	// This function will verify the ticket signature and expiry and return the event and user IDs it was issued for
+	encodedPayload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return 0, 0, errors.New("malformed ticket token")
+	}
+	expected, err := signTicketPayload(encodedPayload)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return 0, 0, errors.New("invalid ticket signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, 0, errors.New("malformed ticket token")
+	}
+	var version string
+	var eventId, userId, expiresAt int64
+	_, err = fmt.Sscanf(strings.ReplaceAll(string(payload), ".", " "), "%s %d %d %d", &version, &eventId, &userId, &expiresAt)
+	if err != nil || version != ticketTokenVersion {
+		return 0, 0, errors.New("malformed ticket token")
+	}
+	if !time.Now().Before(time.Unix(expiresAt, 0)) {
+		return 0, 0, ErrTicketExpired
+	}
+
+	return eventId, userId, nil
+}
+
+func signTicketPayload(encodedPayload string) (string, error) {
+	if len(TicketSecret) == 0 {
+		return "", errNoTicketSecret
+	}
+	mac := hmac.New(sha256.New, TicketSecret)
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
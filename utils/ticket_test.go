@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withTicketSecret(t *testing.T, secret string) {
+	t.Helper()
+	previous := TicketSecret
+	TicketSecret = []byte(secret)
+	t.Cleanup(func() { TicketSecret = previous })
+}
+
+func TestVerifyTicketToken(t *testing.T) {
+	withTicketSecret(t, "ticket-test-secret-of-32-bytes!!")
+	ticket, err := GenerateTicketToken(7, 42, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateTicketToken: %v", err)
+	}
+	expired, err := GenerateTicketToken(7, 42, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GenerateTicketToken: %v", err)
+	}
+	payload, signature, _ := strings.Cut(ticket, ".")
+	forgedPayload := base64.RawURLEncoding.EncodeToString([]byte("t2.7.43.4102444800"))
+	legacyPayload := base64.RawURLEncoding.EncodeToString([]byte("t1.7.42"))
+
+	tests := []struct {
+		name   string
+		ticket string
+		valid  bool
+	}{
+		{"valid ticket", ticket, true},
+		{"expired ticket", expired, false},
+		{"another user", forgedPayload + "." + signature, false},
+		{"tampered signature", payload + "." + strings.Repeat("A", len(signature)), false},
+		{"legacy ticket", legacyPayload + "." + signature, false},
+		{"missing signature", payload, false},
+		{"empty", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventId, userId, err := VerifyTicketToken(test.ticket)
+			if test.valid != (err == nil) {
+				t.Fatalf("VerifyTicketToken() error = %v, want valid %v", err, test.valid)
+			}
+			if test.valid && (eventId != 7 || userId != 42) {
+				t.Fatalf("VerifyTicketToken() = %d, %d, want 7, 42", eventId, userId)
+			}
+		})
+	}
+
+	if _, _, err := VerifyTicketToken(expired); !errors.Is(err, ErrTicketExpired) {
+		t.Errorf("VerifyTicketToken(expired) error = %v, want ErrTicketExpired", err)
+	}
+
+	// A ticket signed with another secret, such as the one formerly hard-coded, is rejected
+	withTicketSecret(t, "another-secret-of-at-least-32-bytes")
+	if _, _, err := VerifyTicketToken(ticket); err == nil {
+		t.Error("VerifyTicketToken() accepted a ticket signed with another secret")
+	}
+}
+
+func TestTicketSecretFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		size  int
+		valid bool
+	}{
+		{"unset", "", 0, true},
+		{"base64 secret", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))), 32, true},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("short")), 0, false},
+		{"not base64", "not base64!", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TICKET_SECRET", test.value)
+			secret, err := TicketSecretFromEnv()
+			if test.valid != (err == nil) || len(secret) != test.size {
+				t.Fatalf("TicketSecretFromEnv() = %d bytes, %v", len(secret), err)
+			}
+		})
+	}
+
+	withTicketSecret(t, "")
+	if _, err := GenerateTicketToken(7, 42, time.Now().Add(time.Hour)); err == nil {
+		t.Error("GenerateTicketToken() signed a ticket without a secret")
+	}
+}
@@ -0,0 +1,181 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ftilie/go-booking-api/apperrors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	MinPasswordLength = 12
+	MaxPasswordBytes  = 72 // bcrypt rejects longer passwords, multi-byte characters count for several bytes
+)
+
+func Register() {
+	// This function will add the custom rules to the validator used by gin bindings.
+	// It must run before any request is bound.
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("Unexpected validator engine, could not register custom validation rules!")
+	}
+
+	// Field names are reported the way clients send them, e.g. "startTime" instead of "StartTime"
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return FieldName(field.Name)
+	})
+
+	register(validate, "future", future)
+	register(validate, "password", password)
+	register(validate, "notblank", notBlank)
+	register(validate, "afterfield", afterField)
+	register(validate, "percentage", percentage)
+}
+
+func register(validate *validator.Validate, tag string, rule validator.Func) {
+	if err := validate.RegisterValidation(tag, rule); err != nil {
+		panic(fmt.Sprintf("Could not register the %s validation rule: %v", tag, err))
+	}
+}
+
+func future(field validator.FieldLevel) bool {
+	// Times must be after the moment the request is validated
+	value, ok := field.Field().Interface().(time.Time)
+	return ok && value.After(time.Now())
+}
+
+func password(field validator.FieldLevel) bool {
+	// Passwords need a minimum length, must fit bcrypt and mix lower case, upper case and digits
+	value := field.Field().String()
+	if len([]rune(value)) < MinPasswordLength || len(value) > MaxPasswordBytes {
+		return false
+	}
+	var lower, upper, digit bool
+	for _, r := range value {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return lower && upper && digit
+}
+
+func notBlank(field validator.FieldLevel) bool {
+	// Strings must contain something other than whitespace
+	return strings.TrimSpace(field.Field().String()) != ""
+}
+
+func afterField(field validator.FieldLevel) bool {
+	// Optional times must be after the time in the named field, when both are set
+	value, ok := field.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+	other, kind, _, found := field.GetStructFieldOK2()
+	if !found || kind == reflect.Pointer || !other.IsValid() {
+		return true // The other time is not set, there is nothing to be after
+	}
+	start, ok := other.Interface().(time.Time)
+	return ok && value.After(start)
+}
+
+func percentage(field validator.FieldLevel) bool {
+	// Values are at most 100 when the kind in the named field is "percentage", other kinds have no cap
+	kind, _, _, found := field.GetStructFieldOK2()
+	if !found || kind.Kind() != reflect.String || kind.String() != "percentage" {
+		return true
+	}
+	return field.Field().Int() <= 100
+}
+
+func FieldName(name string) string {
+	// Go field names are exported, clients use the same names starting with a lower case letter
+	if name == "" {
+		return name
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func Fields(err error) []apperrors.FieldError {
+	// This function will describe every field that failed a rule, in the order the rules were checked
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	fields := make([]apperrors.FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		// Nested fields keep their path without the name of the bound struct, e.g. "cancellationPolicy.fullRefundDays"
+		field := fieldError.Namespace()
+		if _, nested, found := strings.Cut(field, "."); found {
+			field = nested
+		}
+		fields = append(fields, apperrors.FieldError{
+			Field:   field,
+			Rule:    fieldError.Tag(),
+			Message: message(fieldError),
+		})
+	}
+	return fields
+}
+
+func Error(err error) error {
+	// Rule violations become a validation error listing the fields, anything else means the body could not be parsed
+	fields := Fields(err)
+	if len(fields) == 0 {
+		return apperrors.BadRequest("invalid_body", "Invalid input could not be parsed")
+	}
+	return apperrors.Validation("Some fields are invalid", fields...)
+}
+
+func Validate(value any) error {
+	// Checks a value against its binding rules outside of a request binding, e.g. a model mapped from a request
+	if err := binding.Validator.ValidateStruct(value); err != nil {
+		return Error(err)
+	}
+	return nil
+}
+
+func message(fieldError validator.FieldError) string {
+	param := FieldName(fieldError.Param())
+	switch fieldError.Tag() {
+	case "required":
+		return "Is required"
+	case "notblank":
+		return "Must not be blank"
+	case "email":
+		return "Must be a valid email address"
+	case "future":
+		return "Must be in the future"
+	case "password":
+		return fmt.Sprintf("Must be at least %d characters and at most %d bytes long and contain lower case letters, upper case letters and digits", MinPasswordLength, MaxPasswordBytes)
+	case "gtfield", "afterfield":
+		return fmt.Sprintf("Must be after %s", param)
+	case "percentage":
+		return "Percentage discounts cannot exceed 100"
+	case "ltefield":
+		return fmt.Sprintf("Must not be greater than %s", param)
+	case "oneof":
+		return fmt.Sprintf("Must be one of: %s", strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("Must be at most %s characters long", fieldError.Param())
+		}
+		return fmt.Sprintf("Must be at most %s", fieldError.Param())
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("Must be at least %s characters long", fieldError.Param())
+		}
+		return fmt.Sprintf("Must be at least %s", fieldError.Param())
+	}
+	return fmt.Sprintf("Failed on the '%s' rule", fieldError.Tag())
+}